@@ -0,0 +1,6 @@
+-- Go API 的 GORM AutoMigrate 可能已经建过这一列和索引，这里用 IF NOT EXISTS 兼容
+-- AlterTable
+ALTER TABLE "Post" ADD COLUMN IF NOT EXISTS "deletedAt" TIMESTAMPTZ(6);
+
+-- CreateIndex
+CREATE INDEX IF NOT EXISTS "Post_deletedAt_idx" ON "Post"("deletedAt");
@@ -0,0 +1,3 @@
+-- Go API 的 GORM AutoMigrate 可能已经建过这一列，这里用 IF NOT EXISTS 兼容
+-- AlterTable
+ALTER TABLE "Post" ADD COLUMN IF NOT EXISTS "commentCount" INTEGER NOT NULL DEFAULT 0;
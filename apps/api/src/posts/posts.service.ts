@@ -57,7 +57,7 @@ export class PostsService {
 
     // 查 DB
     const posts = await this.prisma.post.findMany({
-       where: {published: true},
+       where: {published: true, deletedAt: null}, // 过滤软删除的帖子
         include: {author: true},
         orderBy: {id: 'desc'},
     });
@@ -69,15 +69,19 @@ export class PostsService {
   }
 
   async findOne(id: number) {
-    return this.prisma.post.findUnique({
-        where:{id},
+    return this.prisma.post.findFirst({
+        where:{id, deletedAt: null},
     });
   }
 
+  // 软删除，和 Go API 保持一致 (版主可以恢复)
   async delete(id: number) {
-    return this.prisma.post.delete({
-        where: {id},
+    const post = await this.prisma.post.update({
+        where: {id, deletedAt: null},
+        data: {deletedAt: new Date()},
     });
+    await this.redis.del(this.cacheKeyService.postsListKey);
+    return post;
   }
 }
 
@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
+	"log"
 	"log/slog"
+	"time"
 
 	"go-api/internal/config" // 引入配置包
 	"go-api/internal/database"
 	"go-api/internal/logger"
+	"go-api/internal/mailer"
 	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/storage"
 	"go-api/internal/router"
 	"go-api/internal/svc"
 	"go-api/internal/worker"
 )
 
+// mqConnectAttempts 启动时连接 MQ 的最大尝试次数 (2s 起指数退避，总共等一分钟左右)
+const mqConnectAttempts = 5
+
 func main() {
 	logger.Init()
 	slog.Info("Server is starting...", "port", 4000) // 结构化写法：消息 + 键值对
@@ -28,28 +36,71 @@ func main() {
 	rdb := database.ConnectRedis(cfg.RedisAddr)
 	defer rdb.Close()
 
-	// 组装 ServiceContext (装箱)
-	serviceCtx := svc.NewServiceContext(cfg, db, rdb)
+	// 初始化消息队列 (MQ_DRIVER=rabbitmq|memory)
+	slog.Info("main:config", "cfg.RabbitMQ.Driver", cfg.RabbitMQ.Driver, "cfg.RabbitMQ.URL", cfg.RabbitMQ.URL, "cfg.RabbitMQ.QueueName", cfg.RabbitMQ.QueueName, "cfg.RabbitMQ.WorkerQueue", cfg.RabbitMQ.WorkerQueue)
+	// 只有显式配置 MQ_DRIVER=memory 才用进程内队列；RabbitMQ 连不上时重试，仍然失败就退出
+	// (降级成内存队列的话消息只在本进程里流转，重启就丢，健康检查还显示正常)
+	broker := connectMQ(cfg.RabbitMQ)
+	defer broker.Close()
+
+	// 邮件发送通道 (MAIL_TRANSPORT=smtp|file|memory)
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatal("❌ Mailer init failed:", err)
+	}
+	defer mail.Close()
 
-	// 1. 初始化 RabbitMQ 连接
-	// 注意：生产环境建议把连接配置放在 global 或者 wire 注入中，这里为了演示简单写
-	// rabbitUrl := fmt.Sprintf("amqp://%s:%s@rabbitmq:5672/", "user", "password")
-	slog.Info("main:config", "cfg.RabbitMQ.URL", cfg.RabbitMQ.URL, "cfg.RabbitMQ.QueueName", cfg.RabbitMQ.QueueName)
-	mqClient, err := mq.NewRabbitMQ(cfg.RabbitMQ.URL, cfg.RabbitMQ.QueueName)
+	// 对象存储 (STORAGE_DRIVER=s3|local)，全局只创建一个客户端
+	store, err := storage.New(cfg.Storage, cfg.AWSHeader)
 	if err != nil {
-		// 如果连不上 MQ，可以选择 panic，或者降级运行
-		slog.Info("⚠️ Warning: RabbitMQ connect failed", "err", err)
-	} else {
-		defer mqClient.Close()
-
-		// 启动消费者 (它会在后台默默工作)
-		// 把 worker.HandleNewPost 函数传进去
-		mqClient.StartConsumer(worker.HandleNewPost)
+		log.Fatal("❌ Storage init failed:", err)
+	}
+
+	// 启动消费者 (它会在后台默默工作)
+	// Dispatcher 按 pattern 分发给注册的处理函数
+	dispatcher := worker.NewNotifierDispatcher(db, cfg, mail)
+	// 图片上传后的异步处理 (去除元数据、生成缩略图)
+	worker.NewImageProcessor(db, store, cfg.Image).Register(dispatcher)
+	broker.StartConsumer(dispatcher.Handle)
+	// 死信落库，管理后台可以查看和重放
+	broker.StartDeadLetterConsumer(worker.SaveDeadLetter(db))
+
+	// 启动 Outbox relay：把事务里写入的消息投递到 MQ
+	worker.NewOutboxRelay(db, broker, cfg.Outbox).Start(context.Background())
+
+	// 每日/每周摘要邮件
+	if cfg.Digest.Enabled {
+		worker.NewDigestJob(db, cfg, mail).Start(context.Background())
+	}
+
+	// 定时清理没有关联到帖子的上传
+	if cfg.Upload.CleanupEnabled {
+		worker.NewAttachmentCleanupJob(db, store, cfg.Upload).Start(context.Background())
 	}
 
+	// 组装 ServiceContext (装箱)
+	serviceCtx := svc.NewServiceContext(cfg, db, rdb, broker, store)
+
 	// 3. 设置并启动路由
 	r := router.SetupRouter(serviceCtx)
 
 	slog.Info("🚀 Server is running on", "port", cfg.ServerPort)
 	r.Run(":" + cfg.ServerPort)
 }
+
+// connectMQ 带指数退避的重试，适合 Docker 启动时 RabbitMQ 还没就绪的场景
+func connectMQ(cfg config.RabbitMQConfig) mq.Broker {
+	delay := 2 * time.Second
+	for i := 1; ; i++ {
+		broker, err := mq.New(cfg)
+		if err == nil {
+			return broker
+		}
+		if i == mqConnectAttempts {
+			log.Fatal("❌ Could not connect to MQ after retries: ", err)
+		}
+		slog.Error("⚠️ Failed to connect to MQ, retrying", "attempt", i, "max", mqConnectAttempts, "retry_in", delay, "err", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -3,7 +3,7 @@ package consts
 import "fmt"
 
 const (
-	// 静态 Key：帖子列表
+	// 静态 Key：帖子列表分页缓存的索引 (Set，记录所有分页 Key，用于统一失效)
 	CacheKeyPostList = "forum:posts:list"
 
 	// 静态 Key：系统公告
@@ -15,7 +15,32 @@ func CacheKeyPostDetail(id uint) string {
 	return fmt.Sprintf("forum:posts:%d", id)
 }
 
-// 动态 Key：用户 Session
+// 动态 Key：帖子列表的某一页 (按筛选条件 + 游标 + 每页条数区分)
+func CacheKeyPostListPage(authorID, published, cursor string, limit int) string {
+	return fmt.Sprintf("forum:posts:list:a=%s:p=%s:c=%s:l=%d", authorID, published, cursor, limit)
+}
+
+// 动态 Key：用户 Session (Hash，field 为 sessionID，一个设备/登录对应一个 session)
 func CacheKeyUserSession(userID uint) string {
 	return fmt.Sprintf("forum:users:%d:session", userID)
 }
+
+// 动态 Key：已注销的 session (吊销名单，存活时间与 access token 一致)
+func CacheKeyRevokedSession(sessionID string) string {
+	return fmt.Sprintf("forum:auth:revoked:%s", sessionID)
+}
+
+// 动态 Key：用户级吊销时间点，在此之前签发的 access token 一律失效
+func CacheKeyUserRevokedBefore(userID uint) string {
+	return fmt.Sprintf("forum:users:%d:revoked_before", userID)
+}
+
+// 动态 Key：一次性令牌 (purpose 区分用途，如 verify_email / reset_password；只存令牌哈希)
+func CacheKeyOneTimeToken(purpose, tokenHash string) string {
+	return fmt.Sprintf("forum:auth:%s:%s", purpose, tokenHash)
+}
+
+// 动态 Key：用户名下还没用掉的一次性令牌 (Set，成员是令牌哈希)，用于一次作废全部
+func CacheKeyOneTimeUserTokens(purpose string, userID uint) string {
+	return fmt.Sprintf("forum:auth:%s:user:%d", purpose, userID)
+}
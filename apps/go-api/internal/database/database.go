@@ -31,7 +31,7 @@ func Connect(dsn string) *gorm.DB {
 
 	// 自动迁移模式
 	log.Println("Running AutoMigrate...")
-	err = db.AutoMigrate(&models.Post{}, &models.User{})
+	err = db.AutoMigrate(&models.Post{}, &models.User{}, &models.Comment{}, &models.AuditLog{}, &models.OutboxEvent{}, &models.DeadLetter{}, &models.Subscription{}, &models.NotificationSetting{}, &models.DigestState{}, &models.EmailSuppression{}, &models.Attachment{}, &models.Blob{}, &models.PostNotificationBatch{}, &models.PostNotificationDelivery{})
 
 	if err != nil {
 		log.Fatal("❌ AutoMigrate failed:", err)
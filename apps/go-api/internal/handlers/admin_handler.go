@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go-api/internal/logger"
+	"go-api/internal/mailer"
+	"go-api/internal/models"
+	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/pagination"
+	"go-api/internal/pkg/response"
+	"go-api/internal/svc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AdminHandler 管理后台接口 (版主/管理员)
+// 所有写操作都会在同一个事务里记录审计日志
+type AdminHandler struct {
+	svc *svc.ServiceContext
+}
+
+func NewAdminHandler(ctx *svc.ServiceContext) *AdminHandler {
+	return &AdminHandler{
+		svc: ctx,
+	}
+}
+
+// PUT /admin/users/:id/role
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	actorID, _ := c.Get("userID")
+
+	targetID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role   string `json:"role" binding:"required"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || !models.IsValidRole(input.Role) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "角色参数错误")
+		return
+	}
+
+	// 不允许修改自己的角色，防止唯一的管理员把自己降级后没人能管
+	if targetID == convertToUint(actorID) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "不能修改自己的角色")
+		return
+	}
+
+	var user models.User
+	if err := h.svc.DB.First(&user, targetID).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeUserNotFound, apperr.GetMsg(apperr.CodeUserNotFound))
+		return
+	}
+	if user.Role == input.Role {
+		// 重复提交：上一次改完角色后注销 session 可能失败了，这里再注销一次
+		if err := h.revokeSessions(c.Request.Context(), user.ID); err != nil {
+			logger.Error(c, "注销全部session失败", "user_id", user.ID, "error", err.Error())
+			response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+			return
+		}
+		response.Success(c, user)
+		return
+	}
+
+	oldRole := user.Role
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("role", input.Role).Error; err != nil {
+			return err
+		}
+		return writeAuditLog(tx, convertToUint(actorID), models.AuditActionUserRoleChange, "user", user.ID,
+			gin.H{"from": oldRole, "to": input.Role}, input.Reason)
+	})
+	if err != nil {
+		logger.Error(c, "修改角色失败", "target_id", targetID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	// 角色写在 JWT 里，注销该用户所有 session，让新角色立即生效 (尤其是降级)
+	// 注销失败不能当作成功返回：降级前签发的 token 会继续带着旧角色，管理员重新提交一次即可
+	if err := h.revokeSessions(c.Request.Context(), user.ID); err != nil {
+		logger.Error(c, "注销全部session失败", "user_id", user.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	logger.Info(c, "user_role_changed", "actor_id", actorID, "target_id", user.ID, "from", oldRole, "to", input.Role)
+	response.Success(c, user)
+}
+
+// revokeSessions 注销用户的全部 session，Redis 抖动时重试几次
+func (h *AdminHandler) revokeSessions(ctx context.Context, userID uint) error {
+	var err error
+	for attempt := 1; attempt <= 3; attempt++ {
+		if err = h.svc.Sessions.RevokeAll(ctx, userID); err == nil {
+			return nil
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+	return err
+}
+
+// DELETE /admin/posts/:id
+// 版主删除任意帖子 (软删除，可恢复)
+func (h *AdminHandler) DeletePost(c *gin.Context) {
+	actorID, _ := c.Get("userID")
+
+	postID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	c.ShouldBindJSON(&input) // reason 可选
+
+	var post models.Post
+	if err := h.svc.DB.First(&post, postID).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeArticleNotExist, apperr.GetMsg(apperr.CodeArticleNotExist))
+		return
+	}
+
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&post).Error; err != nil {
+			return err
+		}
+		return writeAuditLog(tx, convertToUint(actorID), models.AuditActionPostDelete, "post", post.ID,
+			gin.H{"authorId": post.AuthorID, "title": post.Title}, input.Reason)
+	})
+	if err != nil {
+		logger.Error(c, "删除帖子失败", "post_id", postID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	evictPostCache(c, h.svc, post.ID)
+	logger.Info(c, "post_moderated", "actor_id", actorID, "post_id", post.ID, "action", models.AuditActionPostDelete)
+	response.Success(c, nil)
+}
+
+// POST /admin/posts/:id/restore
+// 恢复被软删除的帖子
+func (h *AdminHandler) RestorePost(c *gin.Context) {
+	actorID, _ := c.Get("userID")
+
+	postID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var post models.Post
+	if err := h.svc.DB.Unscoped().Where("\"deletedAt\" IS NOT NULL").First(&post, postID).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeArticleNotExist, apperr.GetMsg(apperr.CodeArticleNotExist))
+		return
+	}
+
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&post).Update("deletedAt", nil).Error; err != nil {
+			return err
+		}
+		return writeAuditLog(tx, convertToUint(actorID), models.AuditActionPostRestore, "post", post.ID,
+			gin.H{"authorId": post.AuthorID, "title": post.Title}, "")
+	})
+	if err != nil {
+		logger.Error(c, "恢复帖子失败", "post_id", postID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	evictPostCache(c, h.svc, post.ID)
+	logger.Info(c, "post_moderated", "actor_id", actorID, "post_id", post.ID, "action", models.AuditActionPostRestore)
+	response.Success(c, post)
+}
+
+// GET /admin/dead-letters?cursor=&limit=&pattern=
+// 按时间倒序查看死信
+func (h *AdminHandler) ListDeadLetters(c *gin.Context) {
+	limit, err := pagination.ParseLimit(c.Query("limit"))
+	if err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "limit 参数错误")
+		return
+	}
+
+	query := h.svc.DB.Model(&models.DeadLetter{})
+	if pattern := c.Query("pattern"); pattern != "" {
+		query = query.Where("pattern = ?", pattern)
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := pagination.Decode(raw)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "cursor 参数错误")
+			return
+		}
+		query = query.Where("(\"createdAt\", id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	var letters []models.DeadLetter
+	if err := query.Order("\"createdAt\" desc").Order("id desc").Limit(limit + 1).Find(&letters).Error; err != nil {
+		logger.Error(c, "查询死信失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	page := response.PageData{List: letters}
+	if len(letters) > limit {
+		letters = letters[:limit]
+		last := letters[len(letters)-1]
+		page.List = letters
+		page.HasMore = true
+		page.NextCursor = pagination.Encode(pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	response.SuccessPage(c, page)
+}
+
+// POST /admin/dead-letters/:id/replay
+// 把死信原样重新投递到主队列 (重试计数清零)，一般在修复了下游问题之后使用
+func (h *AdminHandler) ReplayDeadLetter(c *gin.Context) {
+	actorID, _ := c.Get("userID")
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var letter models.DeadLetter
+	if err := h.svc.DB.First(&letter, id).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeDeadLetterNotExist, apperr.GetMsg(apperr.CodeDeadLetterNotExist))
+		return
+	}
+
+	if err := h.svc.MQ.Replay(c.Request.Context(), []byte(letter.Body)); err != nil {
+		logger.Error(c, "重放死信失败", "dead_letter_id", letter.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	now := time.Now()
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&letter).Updates(map[string]interface{}{
+			"replayCount": gorm.Expr("\"replayCount\" + 1"),
+			"replayedAt":  now,
+		}).Error; err != nil {
+			return err
+		}
+		return writeAuditLog(tx, convertToUint(actorID), models.AuditActionDeadLetterPlay, "dead_letter", letter.ID,
+			gin.H{"pattern": letter.Pattern}, "")
+	})
+	if err != nil {
+		// 消息已经重新投递了，这里只是记录失败，不影响结果
+		logger.Error(c, "更新死信状态失败", "dead_letter_id", letter.ID, "error", err.Error())
+	}
+
+	logger.Info(c, "dead_letter_replayed", "actor_id", actorID, "dead_letter_id", letter.ID, "pattern", letter.Pattern)
+	response.Success(c, nil)
+}
+
+// GET /admin/outbox?status=failed&cursor=&limit=
+// 按时间倒序查看 Outbox 消息，默认只看投递失败的
+func (h *AdminHandler) ListOutboxEvents(c *gin.Context) {
+	limit, err := pagination.ParseLimit(c.Query("limit"))
+	if err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "limit 参数错误")
+		return
+	}
+
+	query := h.svc.DB.Model(&models.OutboxEvent{}).Where("status = ?", c.DefaultQuery("status", models.OutboxStatusFailed))
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := pagination.Decode(raw)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "cursor 参数错误")
+			return
+		}
+		query = query.Where("(\"createdAt\", id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	var events []models.OutboxEvent
+	if err := query.Order("\"createdAt\" desc").Order("id desc").Limit(limit + 1).Find(&events).Error; err != nil {
+		logger.Error(c, "查询Outbox失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	page := response.PageData{List: events}
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[len(events)-1]
+		page.List = events
+		page.HasMore = true
+		page.NextCursor = pagination.Encode(pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	response.SuccessPage(c, page)
+}
+
+// POST /admin/outbox/:id/requeue
+// 投递失败的消息重新排队 (重试次数清零)，relay 下一轮就会投递
+func (h *AdminHandler) RequeueOutboxEvent(c *gin.Context) {
+	actorID, _ := c.Get("userID")
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var event models.OutboxEvent
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("status = ?", models.OutboxStatusFailed).First(&event, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&event).Updates(map[string]interface{}{
+			"status":        models.OutboxStatusPending,
+			"attempts":      0,
+			"nextAttemptAt": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return writeAuditLog(tx, convertToUint(actorID), models.AuditActionOutboxRequeue, "outbox", event.ID,
+			gin.H{"pattern": event.Pattern, "lastError": event.LastError}, "")
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Fail(c, http.StatusNotFound, apperr.CodeOutboxNotExist, apperr.GetMsg(apperr.CodeOutboxNotExist))
+		return
+	}
+	if err != nil {
+		logger.Error(c, "重新排队失败", "outbox_id", id, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	logger.Info(c, "outbox_requeued", "actor_id", actorID, "outbox_id", event.ID, "pattern", event.Pattern)
+	response.Success(c, nil)
+}
+
+// 辅助函数：写审计日志 (需要传入事务，与业务操作同时成功或失败)
+func writeAuditLog(tx *gorm.DB, actorID uint, action, targetType string, targetID uint, detail interface{}, reason string) error {
+	raw, _ := json.Marshal(detail)
+	return tx.Create(&models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     string(raw),
+		Reason:     reason,
+	}).Error
+}
+
+// GET /admin/mail-templates
+// 邮件模板列表，配合预览接口使用
+func (h *AdminHandler) ListMailTemplates(c *gin.Context) {
+	response.Success(c, gin.H{
+		"templates": mailer.TemplateNames(),
+		"locales":   []string{mailer.LocaleZH, mailer.LocaleEN},
+	})
+}
+
+// GET /admin/mail-templates/:name/preview?locale=en&format=html|text
+// 用示例数据渲染邮件，不会真的发信
+// format=html / text 直接返回渲染结果，浏览器里打开就能看；不传则返回 JSON (标题 + 两种正文)
+func (h *AdminHandler) PreviewMailTemplate(c *gin.Context) {
+	locale := c.DefaultQuery("locale", mailer.DefaultLocale)
+	if !mailer.IsSupportedLocale(locale) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "locale 参数错误")
+		return
+	}
+
+	rendered, err := mailer.Preview(c.Param("name"), locale)
+	if errors.Is(err, mailer.ErrTemplateNotFound) {
+		response.Fail(c, http.StatusNotFound, apperr.CodeTemplateNotExist, apperr.GetMsg(apperr.CodeTemplateNotExist))
+		return
+	}
+	if err != nil {
+		logger.Error(c, "渲染邮件模板失败", "template", c.Param("name"), "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	switch c.Query("format") {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(rendered.HTML))
+	case "text":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(rendered.Text))
+	default:
+		response.Success(c, rendered)
+	}
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/internal/logger"
+	"go-api/internal/models"
+	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/blob"
+	"go-api/internal/pkg/pagination"
+	"go-api/internal/pkg/response"
+	"go-api/internal/pkg/upload"
+	"go-api/internal/svc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AttachmentHandler 用户上传的附件
+type AttachmentHandler struct {
+	svc    *svc.ServiceContext
+	policy *upload.Policy
+}
+
+func NewAttachmentHandler(ctx *svc.ServiceContext) *AttachmentHandler {
+	return &AttachmentHandler{
+		svc:    ctx,
+		policy: upload.NewPolicy(ctx.Config.Upload),
+	}
+}
+
+// attachmentView 附件 + 引用的 Blob 的处理结果 + 文件和各尺寸缩略图的访问地址
+// status 是处理状态 (还没完成的直传是 uploading)；只有 ready 的才有 url，图片去除元数据之前不对外提供
+type attachmentView struct {
+	models.Attachment
+	Status      string            `json:"status"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	URL         string            `json:"url"`
+	VariantURLs map[string]string `json:"variantUrls"`
+}
+
+// newAttachmentView b 是附件引用的 Blob，直传还没完成时为 nil
+func newAttachmentView(a models.Attachment, b *models.Blob) attachmentView {
+	view := attachmentView{Attachment: a, Status: a.Status, VariantURLs: map[string]string{}}
+	if b == nil {
+		return view
+	}
+	view.Status, view.Width, view.Height = b.Status, b.Width, b.Height
+	if b.Status != models.BlobReady {
+		return view
+	}
+	view.URL = fileURL(a.Key)
+	for name, key := range b.Variants {
+		view.VariantURLs[name] = fileURL(key)
+	}
+	return view
+}
+
+// loadAttachmentView 查询附件引用的 Blob 后生成 view
+func loadAttachmentView(db *gorm.DB, a models.Attachment) (attachmentView, error) {
+	blobs, err := blob.Load(db, []models.Attachment{a})
+	if err != nil {
+		return attachmentView{}, err
+	}
+	return newAttachmentView(a, blobs[a.Key]), nil
+}
+
+// fileURL 对象的访问地址
+// S3 模式下 /uploads 由 Nginx 转发给 MinIO，local 模式下由 API 自己提供 (见 ServeLocalFile)
+func fileURL(key string) string {
+	return "/uploads/" + key
+}
+
+// GET /attachments/:id
+// 只能查看自己上传的附件，也用来轮询图片处理状态
+func (h *AttachmentHandler) GetAttachment(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var att models.Attachment
+	if err := h.svc.DB.Where("\"ownerId\" = ?", convertToUint(userID)).First(&att, id).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeAttachmentNotExist, apperr.GetMsg(apperr.CodeAttachmentNotExist))
+		return
+	}
+
+	view, err := loadAttachmentView(h.svc.DB, att)
+	if err != nil {
+		logger.Error(c, "查询附件失败", "attachment_id", att.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	response.Success(c, view)
+}
+
+// GET /attachments/usage
+// 当前用户的存储用量和配额 (配额随 Pro 订阅变化，0 表示不限)
+func (h *AttachmentHandler) GetUsage(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var user models.User
+	if err := h.svc.DB.Select("id", "is_pro").First(&user, convertToUint(userID)).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeUserNotFound, apperr.GetMsg(apperr.CodeUserNotFound))
+		return
+	}
+
+	usage, err := attachmentUsage(h.svc.DB, user.ID)
+	if err != nil {
+		logger.Error(c, "查询存储用量失败", "user_id", user.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	response.Success(c, gin.H{
+		"isPro":       user.IsPro,
+		"used":        usage,
+		"quota":       h.policy.Quota(user.IsPro),
+		"maxFileSize": h.policy.MaxSize(user.IsPro),
+	})
+}
+
+// GET /attachments?cursor=&limit=&postId=&unattached=true
+// 当前用户上传的附件，按时间倒序；只列出已登记的 (还没完成的直传不列出来)
+func (h *AttachmentHandler) ListAttachments(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	limit, err := pagination.ParseLimit(c.Query("limit"))
+	if err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "limit 参数错误")
+		return
+	}
+
+	query := h.svc.DB.Model(&models.Attachment{}).
+		Where("\"ownerId\" = ? AND status = ?", convertToUint(userID), models.AttachmentReady)
+	if raw := c.Query("postId"); raw != "" {
+		postID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "postId 参数错误")
+			return
+		}
+		query = query.Where("\"postId\" = ?", postID)
+	} else if c.Query("unattached") == "true" {
+		query = query.Where("\"postId\" IS NULL")
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := pagination.Decode(raw)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "cursor 参数错误")
+			return
+		}
+		query = query.Where("(\"createdAt\", id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	var attachments []models.Attachment
+	if err := query.Order("\"createdAt\" desc").Order("id desc").Limit(limit + 1).Find(&attachments).Error; err != nil {
+		logger.Error(c, "查询附件失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	page := response.PageData{}
+	if len(attachments) > limit {
+		attachments = attachments[:limit]
+		last := attachments[len(attachments)-1]
+		page.HasMore = true
+		page.NextCursor = pagination.Encode(pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	blobs, err := blob.Load(h.svc.DB, attachments)
+	if err != nil {
+		logger.Error(c, "查询附件失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	views := make([]attachmentView, 0, len(attachments))
+	for _, a := range attachments {
+		views = append(views, newAttachmentView(a, blobs[a.Key]))
+	}
+	page.List = views
+	response.SuccessPage(c, page)
+}
+
+// DELETE /attachments/:id
+// 删除自己上传的附件；已经用在帖子里的也可以删，帖子里的附件会消失
+// 相同内容可能还被其它附件引用，这里只释放引用，没有引用的对象 (原图和缩略图) 由清理任务删除
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var att models.Attachment
+	if err := h.svc.DB.Where("\"ownerId\" = ?", convertToUint(userID)).First(&att, id).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeAttachmentNotExist, apperr.GetMsg(apperr.CodeAttachmentNotExist))
+		return
+	}
+
+	var staging []models.Attachment
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		staging, err = blob.RemoveAttachments(tx, []models.Attachment{att})
+		return err
+	})
+	if err != nil {
+		logger.Error(c, "删除附件失败", "attachment_id", att.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	// 附件已经标记删除，临时对象删不掉时交给清理任务
+	if err := blob.PurgeStaging(c.Request.Context(), h.svc.DB, h.svc.Storage, staging); err != nil {
+		logger.Error(c, "删除临时对象失败", "attachment_id", att.ID, "error", err.Error())
+	}
+
+	logger.Info(c, "attachment_deleted", "attachment_id", att.ID, "key", att.Key, "post_id", att.PostID)
+	response.Success(c, nil)
+}
+
+// attachmentUsage 用户已用的存储，包括还没完成的直传 (按声明的大小预占)
+func attachmentUsage(db *gorm.DB, ownerID uint) (upload.Usage, error) {
+	var usage upload.Usage
+	err := db.Model(&models.Attachment{}).
+		Select("COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS files").
+		Where("\"ownerId\" = ?", ownerID).
+		Scan(&usage).Error
+	return usage, err
+}
+
+// errInvalidAttachments 附件不存在、不属于当前用户或已经关联到其它帖子
+var errInvalidAttachments = errors.New("invalid attachments")
+
+// linkAttachments 把附件关联到帖子 (需要传入事务，与帖子的修改同时成功或失败)
+// 只能关联自己上传、已经上传完成、且没有关联到其它帖子的附件
+// replace 为 true 时 ids 是完整列表，不在列表里的附件取消关联 (之后按孤儿处理)
+func linkAttachments(tx *gorm.DB, ownerID, postID uint, ids []uint, replace bool) error {
+	now := time.Now()
+	ids = uniqueIDs(ids)
+
+	if replace {
+		unlink := tx.Model(&models.Attachment{}).Where("\"postId\" = ?", postID)
+		if len(ids) > 0 {
+			unlink = unlink.Where("id NOT IN ?", ids)
+		}
+		if err := unlink.Updates(map[string]interface{}{"postId": nil, "updatedAt": now}).Error; err != nil {
+			return err
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	res := tx.Model(&models.Attachment{}).
+		Where("id IN ? AND \"ownerId\" = ? AND status = ?", ids, ownerID, models.AttachmentReady).
+		Where("\"postId\" IS NULL OR \"postId\" = ?", postID).
+		Updates(map[string]interface{}{"postId": postID, "updatedAt": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != int64(len(ids)) {
+		return errInvalidAttachments
+	}
+	return nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	out := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
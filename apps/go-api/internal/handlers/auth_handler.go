@@ -1,13 +1,21 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"go-api/internal/logger"
+	"go-api/internal/middleware"
 	"go-api/internal/models"
 	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/onetime"
 	"go-api/internal/pkg/response"
+	"go-api/internal/pkg/session"
 	"go-api/internal/svc"
 
 	"github.com/gin-gonic/gin"
@@ -16,12 +24,16 @@ import (
 )
 
 type AuthHandler struct {
-	svc *svc.ServiceContext
+	svc          *svc.ServiceContext
+	verifyTokens *onetime.Store // 邮箱验证令牌
+	resetTokens  *onetime.Store // 重置密码令牌
 }
 
 func NewAuthHandler(ctx *svc.ServiceContext) *AuthHandler {
 	return &AuthHandler{
-		svc: ctx,
+		svc:          ctx,
+		verifyTokens: onetime.NewStore(ctx.Redis, "verify_email", ctx.Config.Auth.EmailVerifyTTL),
+		resetTokens:  onetime.NewStore(ctx.Redis, "reset_password", ctx.Config.Auth.PasswordResetTTL),
 	}
 }
 
@@ -44,6 +56,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	user := models.User{
 		Email:    input.Email,
 		Password: string(hashedPassword),
+		Role:     models.RoleUser,
 	}
 
 	// 2. 存入数据库
@@ -53,10 +66,58 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// 3. 发送验证邮件 (失败不影响注册，用户可以稍后重新发送)
+	h.sendVerificationEmail(c, user)
+
 	// c.JSON(http.StatusCreated, gin.H{"message": "注册成功"})
 	response.Success(c, nil)
 }
 
+// GET /auth/verify?token=
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	userID, err := h.verifyTokens.Consume(c.Request.Context(), c.Query("token"))
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeVerifyInvalid, apperr.GetMsg(apperr.CodeVerifyInvalid))
+		return
+	}
+	if err != nil {
+		logger.Error(c, "校验验证令牌失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	// 只在还没验证过时写入，保留第一次验证的时间
+	if err := h.svc.DB.Model(&models.User{}).
+		Where("id = ? AND \"emailVerifiedAt\" IS NULL", userID).
+		Update("emailVerifiedAt", time.Now()).Error; err != nil {
+		logger.Error(c, "更新验证状态失败", "user_id", userID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	logger.Info(c, "email_verified", "user_id", userID)
+	response.Success(c, nil)
+}
+
+// POST /auth/verify/resend
+// 验证链接过期或没收到时，重新发送一封
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var user models.User
+	if err := h.svc.DB.First(&user, convertToUint(userID)).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeUserNotFound, apperr.GetMsg(apperr.CodeUserNotFound))
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		response.Success(c, nil)
+		return
+	}
+
+	h.sendVerificationEmail(c, user)
+	response.Success(c, nil)
+}
+
 // 登录
 func (h *AuthHandler) Login(c *gin.Context) {
 	var input struct {
@@ -85,26 +146,223 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 3. 签发 JWT (与 NestJS 载荷结构保持一致)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   user.ID,
-		"email": user.Email,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(), // 24小时过期
-	})
+	// 3. 创建 session，签发短期 access token + 可轮换的 refresh token
+	sess, refreshToken, err := h.svc.Sessions.Create(c.Request.Context(), user.ID)
+	if err != nil {
+		logger.Error(c, "创建session失败", "user_id", user.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
 
-	tokenString, err := token.SignedString([]byte(h.svc.Config.JWTSecret))
+	tokenString, err := h.signAccessToken(user, sess.ID)
 	if err != nil {
 		// c.JSON(http.StatusInternalServerError, gin.H{"error": "生成Token失败"})
 		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
 		return
 	}
 
-	// c.JSON(http.StatusOK, gin.H{
-	// 	"access_token": tokenString,
-	// })
 	response.Success(c, gin.H{
-		"access_token": tokenString,
+		"access_token":  tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.svc.Config.Auth.AccessTokenTTL.Seconds()),
 	})
 
 	logger.Info(c, "user_login_success", "user_id", user.ID, "email", user.Email)
 }
+
+// POST /auth/refresh
+// 用 refresh token 换新的 access token，同时轮换 refresh token (旧的立即作废)
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, apperr.GetMsg(apperr.CodeInvalidParam))
+		return
+	}
+
+	sess, refreshToken, err := h.svc.Sessions.Rotate(c.Request.Context(), input.RefreshToken)
+	switch {
+	case errors.Is(err, session.ErrTokenReused):
+		// 旧 token 被重放，可能已泄露：整个 session 已被吊销，需要重新登录
+		logger.Error(c, "refresh_token_reused", "error", err.Error())
+		response.Fail(c, http.StatusUnauthorized, apperr.CodeRefreshReused, apperr.GetMsg(apperr.CodeRefreshReused))
+		return
+	case errors.Is(err, session.ErrInvalidToken):
+		response.Fail(c, http.StatusUnauthorized, apperr.CodeRefreshInvalid, apperr.GetMsg(apperr.CodeRefreshInvalid))
+		return
+	case err != nil:
+		logger.Error(c, "刷新token失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	var user models.User
+	if err := h.svc.DB.First(&user, sess.UserID).Error; err != nil {
+		h.svc.Sessions.Revoke(c.Request.Context(), sess.UserID, sess.ID)
+		response.Fail(c, http.StatusUnauthorized, apperr.CodeUserNotFound, apperr.GetMsg(apperr.CodeUserNotFound))
+		return
+	}
+
+	tokenString, err := h.signAccessToken(user, sess.ID)
+	if err != nil {
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	response.Success(c, gin.H{
+		"access_token":  tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.svc.Config.Auth.AccessTokenTTL.Seconds()),
+	})
+}
+
+// POST /auth/logout
+// 注销当前 session：refresh token 删除，access token 进入吊销名单
+func (h *AuthHandler) Logout(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	sid := c.GetString("sessionID")
+
+	if sid != "" {
+		if err := h.svc.Sessions.Revoke(c.Request.Context(), convertToUint(userID), sid); err != nil {
+			logger.Error(c, "注销session失败", "error", err.Error())
+			response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+			return
+		}
+	}
+
+	logger.Info(c, "user_logout", "user_id", userID, "session_id", sid)
+	response.Success(c, nil)
+}
+
+// POST /auth/forgot-password
+// 无论邮箱是否注册都返回成功，且查库、发信都放到后台，避免通过响应内容或耗时探测账号
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, apperr.GetMsg(apperr.CodeInvalidParam))
+		return
+	}
+
+	traceID := c.GetString(middleware.TraceIDKey)
+	go h.sendPasswordResetEmail(traceID, input.Email)
+
+	response.Success(c, gin.H{"message": "如果该邮箱已注册，你将收到一封重置密码的邮件"})
+}
+
+// POST /auth/reset-password
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, apperr.GetMsg(apperr.CodeInvalidParam))
+		return
+	}
+
+	// 令牌取出即作废，只能用一次
+	userID, err := h.resetTokens.Consume(c.Request.Context(), input.Token)
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeResetInvalid, apperr.GetMsg(apperr.CodeResetInvalid))
+		return
+	}
+	if err != nil {
+		logger.Error(c, "校验重置令牌失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	if err := h.svc.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":  string(hashedPassword),
+		"updatedAt": time.Now(),
+	}).Error; err != nil {
+		logger.Error(c, "更新密码失败", "user_id", userID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	// 改密码后所有设备都要重新登录，其它还没用的重置链接也作废
+	// 吊销失败不能当作成功返回：被盗的 session 会继续有效，重试几次后仍失败就报错
+	if err := h.revokeAfterReset(c.Request.Context(), userID); err != nil {
+		logger.Error(c, "重置密码后注销失败", "user_id", userID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	logger.Info(c, "password_reset", "user_id", userID)
+	response.Success(c, nil)
+}
+
+// revokeAfterReset 注销用户的全部 session 和重置令牌，Redis 抖动时重试几次
+func (h *AuthHandler) revokeAfterReset(ctx context.Context, userID uint) error {
+	var err error
+	for attempt := 1; attempt <= 3; attempt++ {
+		if err = h.svc.Sessions.RevokeAll(ctx, userID); err == nil {
+			err = h.resetTokens.RevokeAll(ctx, userID)
+		}
+		if err == nil {
+			return nil
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+	return err
+}
+
+// sendPasswordResetEmail 在后台执行：查用户、生成令牌、投递到队列
+// 邮箱不存在时什么也不做
+func (h *AuthHandler) sendPasswordResetEmail(traceID, email string) {
+	ctx := context.WithValue(context.Background(), middleware.TraceIDKey, traceID)
+
+	var user models.User
+	if err := h.svc.DB.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return
+	}
+
+	token, err := h.resetTokens.Issue(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "生成重置令牌失败", "user_id", user.ID, "error", err.Error())
+		return
+	}
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", h.svc.Config.App.FrontendURL, url.QueryEscape(token))
+
+	if err := mq.PublishPasswordReset(ctx, h.svc.MQ, user.ID, user.Email, resetURL); err != nil {
+		logger.Error(ctx, "投递重置密码消息失败", "user_id", user.ID, "error", err.Error())
+	}
+}
+
+// sendVerificationEmail 生成验证令牌，通过队列交给 worker 发邮件
+func (h *AuthHandler) sendVerificationEmail(c *gin.Context, user models.User) {
+	token, err := h.verifyTokens.Issue(c.Request.Context(), user.ID)
+	if err != nil {
+		logger.Error(c, "生成验证令牌失败", "user_id", user.ID, "error", err.Error())
+		return
+	}
+	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", h.svc.Config.App.FrontendURL, url.QueryEscape(token))
+
+	if err := mq.PublishUserRegistered(c.Request.Context(), h.svc.MQ, user.ID, user.Email, verifyURL); err != nil {
+		logger.Error(c, "投递验证邮件消息失败", "user_id", user.ID, "error", err.Error())
+	}
+}
+
+// signAccessToken 签发 access token (载荷与 NestJS 保持一致，额外带上 sid 用于吊销、role 用于鉴权)
+func (h *AuthHandler) signAccessToken(user models.User, sessionID string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   user.ID,
+		"email": user.Email,
+		"sid":   sessionID,
+		"role":  user.Role,
+		"iat":   now.Unix(),
+		"exp":   now.Add(h.svc.Config.Auth.AccessTokenTTL).Unix(),
+	})
+	return token.SignedString([]byte(h.svc.Config.JWTSecret))
+}
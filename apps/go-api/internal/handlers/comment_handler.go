@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-api/internal/logger"
+	"go-api/internal/models"
+	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/outbox"
+	"go-api/internal/pkg/pagination"
+	"go-api/internal/pkg/response"
+	"go-api/internal/svc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CommentHandler struct {
+	svc *svc.ServiceContext
+}
+
+func NewCommentHandler(ctx *svc.ServiceContext) *CommentHandler {
+	return &CommentHandler{
+		svc: ctx,
+	}
+}
+
+// GET /posts/:id/comments?cursor=&limit=
+// 按一级评论分页 (时间正序)，每个一级评论带上完整的回复树
+func (h *CommentHandler) ListComments(c *gin.Context) {
+	postID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	limit, err := pagination.ParseLimit(c.Query("limit"))
+	if err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "limit 参数错误")
+		return
+	}
+
+	var post models.Post
+	if err := h.svc.DB.First(&post, postID).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeArticleNotExist, apperr.GetMsg(apperr.CodeArticleNotExist))
+		return
+	}
+
+	// 1. 查一级评论
+	// 已删除的一级评论如果下面还有未删除的回复，要保留成占位节点，否则整层楼都看不到了
+	query := h.svc.DB.Unscoped().
+		Where("\"postId\" = ? AND \"parentId\" IS NULL", postID).
+		Where("\"deletedAt\" IS NULL OR EXISTS (SELECT 1 FROM \"Comment\" r WHERE r.\"rootId\" = \"Comment\".id AND r.\"deletedAt\" IS NULL)")
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := pagination.Decode(raw)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "cursor 参数错误")
+			return
+		}
+		query = query.Where("(\"createdAt\", id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	var roots []*models.Comment
+	if err := query.Order("\"createdAt\" asc").Order("id asc").Limit(limit + 1).Find(&roots).Error; err != nil {
+		logger.Error(c, "查询评论失败", "post_id", postID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	page := response.PageData{}
+	if len(roots) > limit {
+		roots = roots[:limit]
+		last := roots[len(roots)-1]
+		page.HasMore = true
+		page.NextCursor = pagination.Encode(pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	// 2. 按 rootId 一次性取出这一页所有楼层的回复
+	var replies []*models.Comment
+	if len(roots) > 0 {
+		rootIDs := make([]uint, 0, len(roots))
+		for _, r := range roots {
+			rootIDs = append(rootIDs, r.ID)
+		}
+		if err := h.svc.DB.Unscoped().
+			Where("\"rootId\" IN ?", rootIDs).
+			Order("\"createdAt\" asc").Order("id asc").
+			Find(&replies).Error; err != nil {
+			logger.Error(c, "查询回复失败", "post_id", postID, "error", err.Error())
+			response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+			return
+		}
+	}
+
+	page.List = buildCommentTree(roots, replies)
+	response.SuccessPage(c, page)
+}
+
+// POST /posts/:id/comments
+func (h *CommentHandler) CreateComment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.Fail(c, http.StatusUnauthorized, apperr.CodeUnauthorized, apperr.GetMsg(apperr.CodeUnauthorized))
+		return
+	}
+
+	postID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Content  string `json:"content" form:"content" binding:"required"`
+		ParentID *uint  `json:"parentId" form:"parentId"`
+	}
+	if err := c.ShouldBind(&input); err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "评论内容不能为空")
+		return
+	}
+
+	var post models.Post
+	if err := h.svc.DB.First(&post, postID).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeArticleNotExist, apperr.GetMsg(apperr.CodeArticleNotExist))
+		return
+	}
+
+	comment := models.Comment{
+		PostID:    postID,
+		AuthorID:  convertToUint(userID),
+		Content:   input.Content,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	// 回复某条评论：父评论必须属于同一个帖子，rootId 继承父评论所在楼层
+	if input.ParentID != nil {
+		var parent models.Comment
+		if err := h.svc.DB.Where("\"postId\" = ?", postID).First(&parent, *input.ParentID).Error; err != nil {
+			response.Fail(c, http.StatusNotFound, apperr.CodeCommentNotExist, apperr.GetMsg(apperr.CodeCommentNotExist))
+			return
+		}
+		comment.ParentID = &parent.ID
+		if parent.RootID != nil {
+			comment.RootID = parent.RootID
+		} else {
+			comment.RootID = &parent.ID
+		}
+	}
+
+	// 自己评论自己的帖子不用通知；要通知的话先查出作者邮箱
+	var author *models.User
+	if post.AuthorID != comment.AuthorID {
+		author = h.findPostAuthor(c, post)
+	}
+
+	// 评论、评论数、通知消息 (Outbox) 在同一个事务里写入
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Post{}).Where("id = ?", postID).
+			UpdateColumn("commentCount", gorm.Expr("\"commentCount\" + 1")).Error; err != nil {
+			return err
+		}
+		if author == nil {
+			return nil
+		}
+		return mq.PublishPostCommented(c.Request.Context(), outbox.NewWriter(tx), post.ID, comment.ID, post.Title, author.ID, author.Email)
+	})
+	if err != nil {
+		logger.Error(c, "创建评论失败", "post_id", postID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	evictPostCache(c, h.svc, postID)
+	logger.Info(c, "comment_created", "post_id", postID, "comment_id", comment.ID)
+
+	response.Success(c, comment)
+}
+
+// PUT/PATCH /posts/:id/comments/:commentId
+func (h *CommentHandler) UpdateComment(c *gin.Context) {
+	comment, ok := h.loadOwnedComment(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Content string `json:"content" form:"content" binding:"required"`
+	}
+	if err := c.ShouldBind(&input); err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "评论内容不能为空")
+		return
+	}
+
+	if err := h.svc.DB.Model(&comment).Updates(map[string]interface{}{
+		"content":   input.Content,
+		"updatedAt": time.Now(),
+	}).Error; err != nil {
+		logger.Error(c, "更新评论失败", "comment_id", comment.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	response.Success(c, comment)
+}
+
+// DELETE /posts/:id/comments/:commentId
+// 软删除：有回复的评论在树里显示为占位节点
+func (h *CommentHandler) DeleteComment(c *gin.Context) {
+	comment, ok := h.loadOwnedComment(c)
+	if !ok {
+		return
+	}
+
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Post{}).Where("id = ? AND \"commentCount\" > 0", comment.PostID).
+			UpdateColumn("commentCount", gorm.Expr("\"commentCount\" - 1")).Error
+	})
+	if err != nil {
+		logger.Error(c, "删除评论失败", "comment_id", comment.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	evictPostCache(c, h.svc, comment.PostID)
+	logger.Info(c, "comment_deleted", "post_id", comment.PostID, "comment_id", comment.ID)
+	response.Success(c, nil)
+}
+
+// 辅助函数：加载路径中的评论，并校验它属于该帖子、且当前用户是评论作者
+func (h *CommentHandler) loadOwnedComment(c *gin.Context) (models.Comment, bool) {
+	var comment models.Comment
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.Fail(c, http.StatusUnauthorized, apperr.CodeUnauthorized, apperr.GetMsg(apperr.CodeUnauthorized))
+		return comment, false
+	}
+
+	postID, ok := parseIDParam(c, "id")
+	if !ok {
+		return comment, false
+	}
+	commentID, ok := parseIDParam(c, "commentId")
+	if !ok {
+		return comment, false
+	}
+
+	if err := h.svc.DB.Where("\"postId\" = ?", postID).First(&comment, commentID).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeCommentNotExist, apperr.GetMsg(apperr.CodeCommentNotExist))
+		return comment, false
+	}
+
+	if comment.AuthorID != convertToUint(userID) {
+		response.Fail(c, http.StatusForbidden, apperr.CodeForbidden, apperr.GetMsg(apperr.CodeForbidden))
+		return comment, false
+	}
+
+	return comment, true
+}
+
+// 辅助函数：查询帖子作者 (用于发送评论通知)，查不到就不通知
+func (h *CommentHandler) findPostAuthor(c *gin.Context, post models.Post) *models.User {
+	var author models.User
+	if err := h.svc.DB.Select("id", "email").First(&author, post.AuthorID).Error; err != nil {
+		logger.Error(c, "查询帖子作者失败", "post_id", post.ID, "error", err.Error())
+		return nil
+	}
+	return &author
+}
+
+// buildCommentTree 把扁平的回复挂到各自的父评论下
+// 已删除的评论清空内容只保留结构；整棵子树都被删光的节点直接剪掉
+func buildCommentTree(roots, replies []*models.Comment) []*models.Comment {
+	byID := make(map[uint]*models.Comment, len(roots)+len(replies))
+	for _, group := range [][]*models.Comment{roots, replies} {
+		for _, node := range group {
+			node.Replies = []*models.Comment{}
+			if node.DeletedAt.Valid {
+				node.Deleted = true
+				node.Content = ""
+			}
+			byID[node.ID] = node
+		}
+	}
+
+	for _, reply := range replies {
+		if reply.ParentID == nil {
+			continue
+		}
+		if parent, ok := byID[*reply.ParentID]; ok {
+			parent.Replies = append(parent.Replies, reply)
+		}
+	}
+
+	return pruneDeleted(roots)
+}
+
+func pruneDeleted(nodes []*models.Comment) []*models.Comment {
+	kept := make([]*models.Comment, 0, len(nodes))
+	for _, node := range nodes {
+		node.Replies = pruneDeleted(node.Replies)
+		if node.Deleted && len(node.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, node)
+	}
+	return kept
+}
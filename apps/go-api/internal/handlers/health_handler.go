@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/response"
+	"go-api/internal/svc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler 健康检查
+type HealthHandler struct {
+	svc *svc.ServiceContext
+}
+
+func NewHealthHandler(ctx *svc.ServiceContext) *HealthHandler {
+	return &HealthHandler{
+		svc: ctx,
+	}
+}
+
+// GET /healthz
+// 所有依赖都正常返回 200，任意一个异常返回 503，data 里带上每个依赖的状态
+func (h *HealthHandler) Check(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	status := map[string]string{
+		"db":    "ok",
+		"redis": "ok",
+		"mq":    "ok",
+	}
+	healthy := true
+
+	if sqlDB, err := h.svc.DB.DB(); err != nil || sqlDB.PingContext(ctx) != nil {
+		status["db"] = "down"
+		healthy = false
+	}
+	if err := h.svc.Redis.Ping(ctx).Err(); err != nil {
+		status["redis"] = "down"
+		healthy = false
+	}
+	// RabbitMQ 断线后会在后台自动重连，期间报 down
+	if !h.svc.MQ.Connected() {
+		status["mq"] = "down"
+		healthy = false
+	}
+
+	if !healthy {
+		c.JSON(http.StatusServiceUnavailable, response.Response{
+			Code:    apperr.CodeServiceUnavailable,
+			Message: apperr.GetMsg(apperr.CodeServiceUnavailable),
+			Data:    status,
+		})
+		return
+	}
+	response.Success(c, status)
+}
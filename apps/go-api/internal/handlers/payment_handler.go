@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"time"
 
+	"go-api/internal/logger"
 	"go-api/internal/models"
 	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/outbox"
 	"go-api/internal/pkg/response"
 	"go-api/internal/svc"
 
@@ -17,6 +22,7 @@ import (
 	"github.com/stripe/stripe-go/v79/customer"
 	"github.com/stripe/stripe-go/v79/subscription"
 	"github.com/stripe/stripe-go/v79/webhook"
+	"gorm.io/gorm"
 )
 
 type PaymentHandler struct {
@@ -113,58 +119,83 @@ func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
 	}
 
 	// 处理事件
+	// 写库失败时返回 5xx，Stripe 会按自己的策略重试；返回 2xx 的话这次变更就永远丢了
 	switch event.Type {
 	case "checkout.session.completed", "invoice.payment_succeeded":
 		var session stripe.CheckoutSession
-		err := json.Unmarshal(event.Data.Raw, &session)
-		if err == nil {
-			h.handleSubscriptionUpdate(session.Customer.ID, session.Subscription.ID)
+		if json.Unmarshal(event.Data.Raw, &session) == nil {
+			err = h.handleSubscriptionUpdate(session.Customer.ID, session.Subscription.ID)
 		}
 
 	case "customer.subscription.deleted":
 		var sub stripe.Subscription
-		err := json.Unmarshal(event.Data.Raw, &sub)
-		if err == nil {
-			h.handleSubscriptionDeleted(sub.ID)
+		if json.Unmarshal(event.Data.Raw, &sub) == nil {
+			err = h.handleSubscriptionDeleted(sub.ID)
 		}
 	}
+	if err != nil {
+		logger.Error(c, "处理 Stripe 事件失败", "event_id", event.ID, "type", event.Type, "error", err.Error())
+		c.Status(http.StatusInternalServerError)
+		return
+	}
 
 	c.Status(http.StatusOK)
 }
 
 // 内部逻辑：更新订阅状态
-func (h *PaymentHandler) handleSubscriptionUpdate(customerID, subscriptionID string) {
+// 找不到对应用户时忽略 (不是本站的客户，重试也没用)；其它错误返回给调用方，让 Stripe 重试
+func (h *PaymentHandler) handleSubscriptionUpdate(customerID, subscriptionID string) error {
 	// 获取最新的订阅详情
 	sub, err := subscription.Get(subscriptionID, nil)
 	if err != nil {
-		return
+		return err
 	}
 
 	var user models.User
 	if err := h.svc.DB.Where("stripe_customer_id = ?", customerID).First(&user).Error; err != nil {
-		return
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
 	}
 
 	endTime := time.Unix(sub.CurrentPeriodEnd, 0)
 	priceID := sub.Items.Data[0].Price.ID
 
-	// 更新数据库
-	h.svc.DB.Model(&user).Updates(models.User{
-		IsPro:                  true,
-		StripeSubscriptionID:   &sub.ID,
-		StripePriceID:          &priceID,
-		StripeCurrentPeriodEnd: &endTime,
+	// 更新数据库，同一个事务里写入 subscription_changed 事件
+	return h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(models.User{
+			IsPro:                  true,
+			StripeSubscriptionID:   &sub.ID,
+			StripePriceID:          &priceID,
+			StripeCurrentPeriodEnd: &endTime,
+		}).Error; err != nil {
+			return err
+		}
+		return mq.PublishSubscriptionChanged(context.Background(), outbox.NewWriter(tx), user.ID, user.Email, true, &endTime)
 	})
 }
 
 // 内部逻辑：取消订阅
-func (h *PaymentHandler) handleSubscriptionDeleted(subscriptionID string) {
-	h.svc.DB.Model(&models.User{}).
-		Where("stripe_subscription_id = ?", subscriptionID).
-		Updates(map[string]interface{}{
-			"is_pro":                    false,
-			"stripe_subscription_id":    nil,
-			"stripe_price_id":           nil,
-			"stripe_current_period_end": nil,
-		})
+func (h *PaymentHandler) handleSubscriptionDeleted(subscriptionID string) error {
+	var user models.User
+	if err := h.svc.DB.Where("stripe_subscription_id = ?", subscriptionID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).
+			Updates(map[string]interface{}{
+				"is_pro":                    false,
+				"stripe_subscription_id":    nil,
+				"stripe_price_id":           nil,
+				"stripe_current_period_end": nil,
+			}).Error; err != nil {
+			return err
+		}
+		return mq.PublishSubscriptionChanged(context.Background(), outbox.NewWriter(tx), user.ID, user.Email, false, nil)
+	})
 }
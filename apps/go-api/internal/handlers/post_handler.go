@@ -1,20 +1,25 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
-	"go-api/internal/config"
 	"go-api/internal/consts"
 	"go-api/internal/logger"
 	"go-api/internal/models"
 	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/cache"
 	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/outbox"
+	"go-api/internal/pkg/pagination"
 	"go-api/internal/pkg/response"
 	"go-api/internal/svc"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type PostHandler struct {
@@ -27,53 +32,119 @@ func NewPostHandler(ctx *svc.ServiceContext) *PostHandler {
 	}
 }
 
-// GET /posts
+// GET /posts?cursor=&limit=&authorId=&published=
+// 键集分页：按 createdAt desc, id desc 排序，游标记录上一页最后一条的位置
 func (h *PostHandler) GetPosts(c *gin.Context) {
 	ctx := c.Request.Context()
-	cacheKey := consts.CacheKeyPostList
-	logger.Info(c, "开始查询帖子列表", "cache_key", cacheKey)
 
-	// 尝试从 Redis 拿数据
-	cachedData, err := h.svc.Redis.Get(ctx, cacheKey).Result()
-	if err == nil {
-		var posts []models.Post
-		json.Unmarshal([]byte(cachedData), &posts)
-		logger.Info(c, "cache_hit", "key", cacheKey)
-		response.Success(c, posts)
+	// 1. 解析分页与筛选参数
+	limit, err := pagination.ParseLimit(c.Query("limit"))
+	if err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "limit 参数错误")
 		return
 	}
 
-	// 缓存没命中，查数据库
-	var posts []models.Post
-	// 1. 把 created_at 改成 createdAt (Prisma 的列名)
-	// 2. 必须加上转义的双引号 \"...\"，否则 Postgres 会把它转成小写！
-	if err := h.svc.DB.Order("\"createdAt\" desc").Find(&posts).Error; err != nil {
+	rawCursor := c.Query("cursor")
+	var cursor pagination.Cursor
+	if rawCursor != "" {
+		if cursor, err = pagination.Decode(rawCursor); err != nil {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "cursor 参数错误")
+			return
+		}
+	}
+
+	authorID := c.Query("authorId")
+	if authorID != "" {
+		if _, err := strconv.ParseUint(authorID, 10, 64); err != nil {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "authorId 参数错误")
+			return
+		}
+	}
+
+	published := c.Query("published")
+	if published != "" {
+		b, err := strconv.ParseBool(published)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "published 参数错误")
+			return
+		}
+		published = strconv.FormatBool(b) // 统一成 true/false，避免 "1"/"true" 产生两份缓存
+	}
+
+	cacheKey := consts.CacheKeyPostListPage(authorID, published, rawCursor, limit)
+	logger.Info(c, "开始查询帖子列表", "cache_key", cacheKey)
+
+	// 2. Cache-Aside：先读缓存，未命中再查库 (并发未命中只会查一次库)
+	var page response.PageData
+	err = h.svc.Cache.FetchIndexed(ctx, consts.CacheKeyPostList, cacheKey, 5*time.Minute, &page, func(ctx context.Context) (interface{}, error) {
+		logger.Info(c, "cache_miss_db_query", "key", cacheKey)
+
+		// 注意：Prisma 的列名是驼峰，必须加上转义的双引号，否则 Postgres 会把它转成小写！
+		query := h.svc.DB.WithContext(ctx).Model(&models.Post{})
+		if authorID != "" {
+			query = query.Where("\"authorId\" = ?", authorID)
+		}
+		if published != "" {
+			query = query.Where("published = ?", published == "true")
+		}
+		if rawCursor != "" {
+			// 行比较：(createdAt, id) 严格小于游标位置
+			query = query.Where("(\"createdAt\", id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+
+		// 多取一条，用来判断是否还有下一页
+		var posts []models.Post
+		if err := query.Order("\"createdAt\" desc").Order("id desc").Limit(limit + 1).Find(&posts).Error; err != nil {
+			return nil, err
+		}
+
+		result := response.PageData{List: posts}
+		if len(posts) > limit {
+			posts = posts[:limit]
+			last := posts[len(posts)-1]
+			result.List = posts
+			result.HasMore = true
+			result.NextCursor = pagination.Encode(pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
+		return result, nil
+	})
+	if err != nil {
 		logger.Error(c, "数据库查询失败", "error", err.Error())
-		// c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
 		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
 		return
 	}
 
-	logger.Info(c, "cache_miss_db_query", "key", cacheKey)
-
-	// 回写 Redis，设置过期时间 (比如 5 分钟)
-	jsonData, _ := json.Marshal(posts)
-	h.svc.Redis.Set(ctx, cacheKey, jsonData, 5*time.Minute)
-
-	response.Success(c, posts)
-	// c.JSON(http.StatusOK, posts)
+	response.SuccessPage(c, page)
 }
 
 // GET /posts/:id
 func (h *PostHandler) GetPostDetail(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	// 不存在的 ID 也会被短暂缓存 (负缓存)，防止被恶意刷不存在的 ID 打穿到数据库
 	var post models.Post
-	if err := h.svc.DB.First(&post, id).Error; err != nil {
-		// c.JSON(http.StatusNotFound, gin.H{"error": "文章不存在"})
+	err := h.svc.Cache.Fetch(c.Request.Context(), consts.CacheKeyPostDetail(id), 10*time.Minute, &post, func(ctx context.Context) (interface{}, error) {
+		var p models.Post
+		if err := h.svc.DB.WithContext(ctx).First(&p, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, cache.ErrNotFound
+			}
+			return nil, err
+		}
+		return p, nil
+	})
+	if errors.Is(err, cache.ErrNotFound) {
 		response.Fail(c, http.StatusNotFound, apperr.CodeArticleNotExist, apperr.GetMsg(apperr.CodeArticleNotExist))
 		return
 	}
-	// c.JSON(http.StatusOK, post)
+	if err != nil {
+		logger.Error(c, "查询帖子详情失败", "post_id", id, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
 	response.Success(c, post)
 }
 
@@ -93,6 +164,8 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 		Title string `json:"title" form:"title" binding:"required"`
 		// form:"content"
 		Content string `json:"content" form:"content"`
+		// 帖子里用到的附件 (上传接口返回的 id)
+		AttachmentIDs []uint `json:"attachmentIds" form:"attachmentIds"`
 	}
 
 	// 2. 修改这里：从 ShouldBindJSON 改为 ShouldBind
@@ -103,6 +176,19 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 		return
 	}
 
+	// 开启了强制验证时，未验证邮箱的用户不能发帖
+	if h.svc.Config.Auth.RequireVerifiedEmail {
+		var author models.User
+		if err := h.svc.DB.Select("id", "emailVerifiedAt").First(&author, convertToUint(userID)).Error; err != nil {
+			response.Fail(c, http.StatusNotFound, apperr.CodeUserNotFound, apperr.GetMsg(apperr.CodeUserNotFound))
+			return
+		}
+		if author.EmailVerifiedAt == nil {
+			response.Fail(c, http.StatusForbidden, apperr.CodeEmailUnverified, apperr.GetMsg(apperr.CodeEmailUnverified))
+			return
+		}
+	}
+
 	// 2. 转换成数据库模型
 	newPost := models.Post{
 		Title:     input.Title,
@@ -113,35 +199,177 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 		AuthorID:  convertToUint(userID),
 	}
 
-	// 3. 写入数据库
-	if err := h.svc.DB.Create(&newPost).Error; err != nil {
+	// 3. 写入数据库，新帖消息写进 Outbox，与帖子在同一个事务里提交
+	// 由 worker 的 Outbox relay 负责投递到 MQ，进程崩溃或 MQ 宕机都不会丢消息
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newPost).Error; err != nil {
+			return err
+		}
+		if err := linkAttachments(tx, newPost.AuthorID, newPost.ID, input.AttachmentIDs, false); err != nil {
+			return err
+		}
+		return mq.PublishNewPost(c.Request.Context(), outbox.NewWriter(tx), newPost.ID, newPost.AuthorID, newPost.Title)
+	})
+	if errors.Is(err, errInvalidAttachments) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "附件参数错误")
+		return
+	}
+	if err != nil {
+		logger.Error(c, "创建帖子失败", "error", err.Error())
 		// c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
 		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
 		return
 	}
 
-	cacheKey := consts.CacheKeyPostList
-	h.svc.Redis.Del(c.Request.Context(), cacheKey)
-	logger.Info(c, "cache_evicted", "key", cacheKey)
-
-	cfg := config.Load() // 或者从 svc 中获取，如果在 svc 中存了的话
-	logger.Info(c, "config", "cfg.RabbitMQ.URL", cfg.RabbitMQ.URL, "cfg.RabbitMQ.QueueName", cfg.RabbitMQ.QueueName)
-
-	// 异步发送消息
-	// 注意：实际生产中建议单例注入 mq 实例，不要每次 New
-	go func() {
-		mqClient, err := mq.NewRabbitMQ(cfg.RabbitMQ.URL, cfg.RabbitMQ.QueueName)
-		if err == nil {
-			defer mqClient.Close()
-			mqClient.PublishNewPost(newPost.ID, newPost.Title)
-		}
-	}()
+	// 新 ID 可能之前被探测过 (负缓存)，详情和列表一起失效
+	evictPostCache(c, h.svc, newPost.ID)
 
 	// 4. 返回成功，结果与 NestJS 保持一致
 	// c.JSON(http.StatusCreated, newPost)
 	response.Success(c, newPost)
 }
 
+// PUT/PATCH /posts/:id
+// 只有作者本人可以修改，字段不传则保持原值
+func (h *PostHandler) UpdatePost(c *gin.Context) {
+	post, ok := h.loadOwnedPost(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Title     *string `json:"title" form:"title"`
+		Content   *string `json:"content" form:"content"`
+		Published *bool   `json:"published" form:"published"`
+		// 传了就是帖子完整的附件列表，不在列表里的附件会取消关联；不传保持不变
+		AttachmentIDs *[]uint `json:"attachmentIds" form:"attachmentIds"`
+	}
+	if err := c.ShouldBind(&input); err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, apperr.GetMsg(apperr.CodeInvalidParam))
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Title != nil {
+		if *input.Title == "" {
+			response.Fail(c, http.StatusBadRequest, apperr.CodeTitleNotExist, apperr.GetMsg(apperr.CodeTitleNotExist))
+			return
+		}
+		updates["title"] = *input.Title
+	}
+	if input.Content != nil {
+		updates["content"] = *input.Content
+	}
+	if input.Published != nil {
+		updates["published"] = *input.Published
+	}
+	// Prisma 的 @updatedAt 是在客户端维护的，数据库里没有触发器，这里要手动更新
+	updates["updatedAt"] = time.Now()
+
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&post).Updates(updates).Error; err != nil {
+			return err
+		}
+		if input.AttachmentIDs == nil {
+			return nil
+		}
+		return linkAttachments(tx, post.AuthorID, post.ID, *input.AttachmentIDs, true)
+	})
+	if errors.Is(err, errInvalidAttachments) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "附件参数错误")
+		return
+	}
+	if err != nil {
+		logger.Error(c, "更新帖子失败", "post_id", post.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	evictPostCache(c, h.svc, post.ID)
+	logger.Info(c, "post_updated", "post_id", post.ID)
+	response.Success(c, post)
+}
+
+// DELETE /posts/:id
+// 软删除：只写 deletedAt，数据保留，方便版主恢复
+// 附件同时取消关联，宽限期过后按孤儿清理，不再占用作者的存储配额
+func (h *PostHandler) DeletePost(c *gin.Context) {
+	post, ok := h.loadOwnedPost(c)
+	if !ok {
+		return
+	}
+
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&post).Error; err != nil {
+			return err
+		}
+		return linkAttachments(tx, post.AuthorID, post.ID, nil, true)
+	})
+	if err != nil {
+		logger.Error(c, "删除帖子失败", "post_id", post.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	evictPostCache(c, h.svc, post.ID)
+	logger.Info(c, "post_deleted", "post_id", post.ID)
+	response.Success(c, nil)
+}
+
+// 辅助函数：按路径参数加载帖子，并校验当前登录用户是否为作者
+// 校验失败时已经写好了响应，调用方直接 return 即可
+func (h *PostHandler) loadOwnedPost(c *gin.Context) (models.Post, bool) {
+	var post models.Post
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.Fail(c, http.StatusUnauthorized, apperr.CodeUnauthorized, apperr.GetMsg(apperr.CodeUnauthorized))
+		return post, false
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return post, false
+	}
+
+	if err := h.svc.DB.First(&post, id).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeArticleNotExist, apperr.GetMsg(apperr.CodeArticleNotExist))
+		return post, false
+	}
+
+	if post.AuthorID != convertToUint(userID) {
+		response.Fail(c, http.StatusForbidden, apperr.CodeForbidden, apperr.GetMsg(apperr.CodeForbidden))
+		return post, false
+	}
+
+	return post, true
+}
+
+// 辅助函数：帖子变更后的缓存失效钩子，创建/更新/删除帖子以及评论数变化时都要调用
+func evictPostCache(c *gin.Context, svcCtx *svc.ServiceContext, postID uint) {
+	cacheKey := consts.CacheKeyPostDetail(postID)
+	svcCtx.Cache.Invalidate(c.Request.Context(), cacheKey)
+	logger.Info(c, "cache_evicted", "key", cacheKey)
+
+	evictPostListCache(c, svcCtx)
+}
+
+// 辅助函数：清空所有帖子列表分页缓存
+func evictPostListCache(c *gin.Context, svcCtx *svc.ServiceContext) {
+	svcCtx.Cache.InvalidateIndex(c.Request.Context(), consts.CacheKeyPostList)
+	logger.Info(c, "cache_evicted", "key", consts.CacheKeyPostList)
+}
+
+// 辅助函数：解析路径里的数字 ID，失败时直接返回 400
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, apperr.GetMsg(apperr.CodeInvalidParam))
+		return 0, false
+	}
+	return uint(id), true
+}
+
 // 辅助函数：处理 JWT 解析后恼人的数字类型问题
 func convertToUint(val interface{}) uint {
 	switch v := val.(type) {
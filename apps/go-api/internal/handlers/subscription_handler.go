@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-api/internal/logger"
+	"go-api/internal/mailer"
+	"go-api/internal/models"
+	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/response"
+	"go-api/internal/svc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SubscriptionHandler 关注作者/订阅论坛，以及邮件通知偏好
+type SubscriptionHandler struct {
+	svc *svc.ServiceContext
+}
+
+func NewSubscriptionHandler(ctx *svc.ServiceContext) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		svc: ctx,
+	}
+}
+
+// GET /subscriptions
+func (h *SubscriptionHandler) ListSubscriptions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var subs []models.Subscription
+	if err := h.svc.DB.Where("\"userId\" = ?", convertToUint(userID)).Order("id desc").Find(&subs).Error; err != nil {
+		logger.Error(c, "查询订阅失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	response.Success(c, subs)
+}
+
+// POST /subscriptions/forum 订阅整个论坛的新帖
+func (h *SubscriptionHandler) SubscribeForum(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	h.subscribe(c, convertToUint(userID), models.SubscriptionTargetForum, 0)
+}
+
+// DELETE /subscriptions/forum
+func (h *SubscriptionHandler) UnsubscribeForum(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	h.unsubscribe(c, convertToUint(userID), models.SubscriptionTargetForum, 0)
+}
+
+// POST /users/:id/follow 关注作者
+func (h *SubscriptionHandler) FollowAuthor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	authorID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if authorID == convertToUint(userID) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "不能关注自己")
+		return
+	}
+
+	var author models.User
+	if err := h.svc.DB.Select("id").First(&author, authorID).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeUserNotFound, apperr.GetMsg(apperr.CodeUserNotFound))
+		return
+	}
+
+	h.subscribe(c, convertToUint(userID), models.SubscriptionTargetAuthor, authorID)
+}
+
+// DELETE /users/:id/follow
+func (h *SubscriptionHandler) UnfollowAuthor(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	authorID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	h.unsubscribe(c, convertToUint(userID), models.SubscriptionTargetAuthor, authorID)
+}
+
+// subscribe 幂等：已经订阅过直接返回成功
+func (h *SubscriptionHandler) subscribe(c *gin.Context, userID uint, targetType string, targetID uint) {
+	sub := models.Subscription{
+		UserID:     userID,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+	if err := h.svc.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&sub).Error; err != nil {
+		logger.Error(c, "订阅失败", "target_type", targetType, "target_id", targetID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	logger.Info(c, "订阅成功", "target_type", targetType, "target_id", targetID)
+	response.Success(c, nil)
+}
+
+// unsubscribe 幂等：没有订阅也返回成功
+func (h *SubscriptionHandler) unsubscribe(c *gin.Context, userID uint, targetType string, targetID uint) {
+	err := h.svc.DB.
+		Where("\"userId\" = ? AND \"targetType\" = ? AND \"targetId\" = ?", userID, targetType, targetID).
+		Delete(&models.Subscription{}).Error
+	if err != nil {
+		logger.Error(c, "取消订阅失败", "target_type", targetType, "target_id", targetID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	logger.Info(c, "取消订阅成功", "target_type", targetType, "target_id", targetID)
+	response.Success(c, nil)
+}
+
+// GET /notification-settings
+func (h *SubscriptionHandler) GetNotificationSettings(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	setting, err := h.loadSetting(convertToUint(userID))
+	if err != nil {
+		logger.Error(c, "查询通知设置失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	response.Success(c, setting)
+}
+
+// PUT /notification-settings
+// 只更新传了的字段；newPostFrequency 为 immediate / daily / weekly / off
+// unsubscribed=true 退订所有通知邮件，false 恢复；locale 为邮件语言 (zh / en)
+func (h *SubscriptionHandler) UpdateNotificationSettings(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input struct {
+		NewPostFrequency *string `json:"newPostFrequency"`
+		Unsubscribed     *bool   `json:"unsubscribed"`
+		Locale           *string `json:"locale"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil ||
+		(input.NewPostFrequency != nil && !models.IsValidFrequency(*input.NewPostFrequency)) ||
+		(input.Locale != nil && !mailer.IsSupportedLocale(*input.Locale)) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, apperr.GetMsg(apperr.CodeInvalidParam))
+		return
+	}
+
+	setting, err := h.loadSetting(convertToUint(userID))
+	if err == nil {
+		if input.NewPostFrequency != nil {
+			setting.NewPostFrequency = *input.NewPostFrequency
+		}
+		if input.Locale != nil {
+			setting.Locale = *input.Locale
+		}
+		if input.Unsubscribed != nil {
+			if !*input.Unsubscribed {
+				setting.UnsubscribedAt = nil
+			} else if setting.UnsubscribedAt == nil {
+				now := time.Now()
+				setting.UnsubscribedAt = &now
+			}
+		}
+		// 主键是 userId，Save 会按主键 upsert
+		err = h.svc.DB.Save(&setting).Error
+	}
+	if err == nil && input.Unsubscribed != nil {
+		// 抑制列表和退订状态保持一致：退订时加入，重新开启时移除
+		err = h.syncSuppression(convertToUint(userID), *input.Unsubscribed)
+	}
+	if err != nil {
+		logger.Error(c, "更新通知设置失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	logger.Info(c, "通知设置已更新", "new_post_frequency", setting.NewPostFrequency, "unsubscribed", setting.UnsubscribedAt != nil)
+	response.Success(c, setting)
+}
+
+func (h *SubscriptionHandler) syncSuppression(userID uint, unsubscribed bool) error {
+	if !unsubscribed {
+		return resubscribeUser(h.svc.DB, userID)
+	}
+
+	var user models.User
+	if err := h.svc.DB.Select("id", "email").First(&user, userID).Error; err != nil {
+		return err
+	}
+	return unsubscribeUser(h.svc.DB, user)
+}
+
+// loadSetting 读取通知设置，没有记录时返回默认值
+func (h *SubscriptionHandler) loadSetting(userID uint) (models.NotificationSetting, error) {
+	var setting models.NotificationSetting
+	err := h.svc.DB.Where("\"userId\" = ?", userID).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultNotificationSetting(userID), nil
+	}
+	return setting, err
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api/internal/logger"
+	"go-api/internal/models"
+	"go-api/internal/pkg/unsubscribe"
+	"go-api/internal/svc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 退订页面是用户从邮件里直接打开的，返回 HTML 而不是 JSON
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Unsubscribe</title></head>
+<body style="font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,'PingFang SC','Microsoft YaHei',sans-serif;max-width:480px;margin:48px auto;padding:0 16px;color:#333;line-height:1.6;">
+{{if .Invalid}}<p>退订链接无效。<br>This unsubscribe link is invalid.</p>
+{{else if .Done}}<p>已退订，你不会再收到通知类邮件。<br>You have been unsubscribed from notification emails.</p>
+<p style="font-size:12px;color:#999;">可以随时在通知设置里重新开启。You can turn them back on in your notification settings.</p>
+{{else}}<p>确定不再接收通知类邮件吗？<br>Stop receiving notification emails?</p>
+<form method="post"><button type="submit" style="padding:8px 20px;">退订 / Unsubscribe</button></form>
+{{end}}
+</body>
+</html>
+`))
+
+// UnsubscribeHandler 处理邮件里的退订链接 (公开接口，靠签名令牌识别用户)
+type UnsubscribeHandler struct {
+	svc    *svc.ServiceContext
+	signer *unsubscribe.Signer
+}
+
+func NewUnsubscribeHandler(ctx *svc.ServiceContext) *UnsubscribeHandler {
+	return &UnsubscribeHandler{
+		svc:    ctx,
+		signer: unsubscribe.NewSigner(ctx.Config.Mail.UnsubscribeSecret),
+	}
+}
+
+// GET /unsubscribe?token=
+// 只展示确认页面，不做退订：邮件安全网关会预先抓取链接，GET 直接退订会误伤
+func (h *UnsubscribeHandler) Confirm(c *gin.Context) {
+	if _, err := h.signer.Verify(c.Query("token")); err != nil {
+		h.render(c, http.StatusBadRequest, gin.H{"Invalid": true})
+		return
+	}
+	h.render(c, http.StatusOK, gin.H{})
+}
+
+// POST /unsubscribe?token=
+// RFC 8058 一键退订：邮件客户端 POST "List-Unsubscribe=One-Click"，确认页面的按钮也提交到这里
+// 退订是幂等的，重复提交也返回成功
+func (h *UnsubscribeHandler) Unsubscribe(c *gin.Context) {
+	userID, err := h.signer.Verify(c.Query("token"))
+	if err != nil {
+		h.render(c, http.StatusBadRequest, gin.H{"Invalid": true})
+		return
+	}
+
+	var user models.User
+	if err := h.svc.DB.Select("id", "email").First(&user, userID).Error; err != nil {
+		// 用户已经不存在了，对调用方来说等同于退订成功
+		h.render(c, http.StatusOK, gin.H{"Done": true})
+		return
+	}
+
+	if err := unsubscribeUser(h.svc.DB, user); err != nil {
+		logger.Error(c, "退订失败", "user_id", userID, "error", err.Error())
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info(c, "用户已退订通知邮件", "user_id", userID, "one_click", c.PostForm("List-Unsubscribe") == "One-Click")
+	h.render(c, http.StatusOK, gin.H{"Done": true})
+}
+
+func (h *UnsubscribeHandler) render(c *gin.Context, status int, data gin.H) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := unsubscribePage.Execute(c.Writer, data); err != nil {
+		logger.Error(c, "渲染退订页面失败", "error", err.Error())
+	}
+}
+
+// unsubscribeUser 标记退订并把邮箱加入抑制列表 (同一个事务)
+func unsubscribeUser(db *gorm.DB, user models.User) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		setting := models.DefaultNotificationSetting(user.ID)
+		setting.UnsubscribedAt = &now
+		// 已有设置时只更新 unsubscribedAt，保留用户的其它偏好
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "userId"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"unsubscribedAt": now, "updatedAt": now}),
+		}).Create(&setting).Error; err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.EmailSuppression{
+			Email:  strings.ToLower(user.Email),
+			Reason: models.SuppressionUnsubscribe,
+			UserID: &user.ID,
+		}).Error
+	})
+}
+
+// resubscribeUser 用户在设置里重新开启通知，移除退订产生的抑制记录 (退信、投诉的记录保留)
+func resubscribeUser(db *gorm.DB, userID uint) error {
+	return db.Where("\"userId\" = ? AND reason = ?", userID, models.SuppressionUnsubscribe).
+		Delete(&models.EmailSuppression{}).Error
+}
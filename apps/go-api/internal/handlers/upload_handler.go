@@ -1,42 +1,552 @@
 package handlers
 
 import (
-	"fmt"
-	"go-api/internal/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/logger"
+	"go-api/internal/models"
+	"go-api/internal/pkg/apperr"
+	"go-api/internal/pkg/blob"
+	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/outbox"
 	"go-api/internal/pkg/response"
 	"go-api/internal/pkg/storage"
-	"net/http"
+	"go-api/internal/pkg/upload"
+	"go-api/internal/svc"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func Upload(c *gin.Context) {
-	// 1. 获取文件
+// multipartOverhead 表单边界和其它字段的余量，请求体超过 文件上限+余量 时直接中断读取
+const multipartOverhead = 1 << 20
+
+// UploadHandler 文件上传，存储后端由 STORAGE_DRIVER 决定
+type UploadHandler struct {
+	svc    *svc.ServiceContext
+	policy *upload.Policy
+}
+
+func NewUploadHandler(ctx *svc.ServiceContext) *UploadHandler {
+	return &UploadHandler{
+		svc:    ctx,
+		policy: upload.NewPolicy(ctx.Config.Upload),
+	}
+}
+
+// POST /upload
+// 文件类型以服务端嗅探为准，扩展名必须和内容一致；单文件大小和总配额按套餐区分
+func (h *UploadHandler) Upload(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	// 1. 获取文件 (限制请求体大小，避免超大文件先被完整读到临时目录)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.policy.MaxSize(user.IsPro)+multipartOverhead)
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
-		response.Fail(c, http.StatusBadRequest, 40001, "No file uploaded")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.Fail(c, http.StatusRequestEntityTooLarge, apperr.CodeFileTooLarge, apperr.GetMsg(apperr.CodeFileTooLarge))
+			return
+		}
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, "No file uploaded")
 		return
 	}
 	defer file.Close()
 
-	// 2. 初始化 S3 服务 (实际项目中应该在 main.go 初始化并注入，这里为了简单直接创建)
-	cfg := config.Load()
-	s3Service, err := storage.NewS3Service(cfg.AWSHeader)
+	// 2. 校验大小、类型和扩展名
+	result, err := h.policy.Check(file, header.Filename, header.Size, user.IsPro)
+	if err != nil {
+		failUpload(c, err)
+		return
+	}
+
+	// 3. 先粗略检查一次配额，明显超额的不用再上传到存储 (登记时还会在事务里加锁再查一次)
+	usage, err := attachmentUsage(h.svc.DB, user.ID)
+	if err != nil {
+		logger.Error(c, "查询存储用量失败", "user_id", user.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	if err := h.policy.Quota(user.IsPro).Allow(usage, header.Size); err != nil {
+		failUpload(c, err)
+		return
+	}
+
+	// 4. 计算 SHA-256，相同内容使用同一个 key (按内容寻址)
+	ctx := c.Request.Context()
+	checksum, err := blob.Checksum(file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		failUpload(c, err)
+		return
+	}
+	key := blob.Key(checksum, result.Ext)
+
+	// 5. 先写到私有的暂存位置，不在事务里访问存储；登记之后只有第一次出现的内容才复制过去
+	staging := blob.StagingKey(result.Ext)
+	if err := h.svc.Storage.Put(ctx, staging, file, header.Size, result.ContentType); err != nil {
+		logger.Error(c, "保存文件失败", "key", staging, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	defer h.deleteObject(c, staging)
+
+	// 6. 短事务：加锁检查配额、引用对象、记录附件
+	b := models.Blob{
+		Key:      key,
+		Checksum: checksum,
+		Size:     header.Size,
+		MimeType: result.ContentType,
+		Status:   models.BlobStoring,
+	}
+	att := models.Attachment{
+		OwnerID:  user.ID,
+		Key:      key,
+		Size:     header.Size,
+		MimeType: result.ContentType,
+		Checksum: checksum,
+		Status:   models.AttachmentReady,
+	}
+	var fresh bool
+	err = h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := h.reserveQuota(tx, user, att.Size); err != nil {
+			return err
+		}
+		var err error
+		if fresh, err = blob.Acquire(tx, &b); err != nil {
+			return err
+		}
+		return tx.Create(&att).Error
+	})
+	if errors.Is(err, upload.ErrQuotaExceeded) || errors.Is(err, blob.ErrDeleting) {
+		failUpload(c, err)
+		return
+	}
+	if err != nil {
+		logger.Error(c, "保存附件失败", "key", key, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	// 7. 第一次出现的内容：复制到 Blob 的位置，图片交给 worker 处理；失败时删掉这个附件，不占配额
+	if fresh {
+		err := h.storeBlob(ctx, &b, staging, func(tx *gorm.DB) error {
+			return tx.Delete(&att).Error
+		})
+		if err != nil {
+			logger.Error(c, "保存附件失败", "key", key, "error", err.Error())
+			response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+			return
+		}
+	}
+
+	logger.Info(c, "file_uploaded", "user_id", user.ID, "attachment_id", att.ID, "key", key, "size", header.Size, "content_type", result.ContentType, "deduplicated", !fresh)
+	response.Success(c, newAttachmentView(att, &b))
+}
+
+// POST /upload/presign
+// 签发直传地址，文件不经过 API 直接上传到存储 (大文件用这个)
+// 先按声明的类型和大小做同样的校验，附件记录为 uploading，客户端上传完成后调用 /upload/complete
+// 上传的内容要等登记时才知道，所以先传到一个临时 key，登记时再复制到按内容寻址的 key
+func (h *UploadHandler) Presign(c *gin.Context) {
+	var input struct {
+		Filename    string `json:"filename" binding:"required"`
+		ContentType string `json:"contentType" binding:"required"`
+		Size        int64  `json:"size" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, apperr.GetMsg(apperr.CodeInvalidParam))
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	contentType := strings.ToLower(strings.TrimSpace(input.ContentType))
+	result, err := h.policy.CheckDeclared(input.Filename, contentType, input.Size, user.IsPro)
+	if err != nil {
+		failUpload(c, err)
+		return
+	}
+
+	att := models.Attachment{
+		OwnerID:  user.ID,
+		Key:      blob.StagingKey(result.Ext),
+		Size:     input.Size,
+		MimeType: result.ContentType,
+		Status:   models.AttachmentUploading,
+	}
+	// 未完成的直传按声明的大小预占配额
+	err = h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := h.reserveQuota(tx, user, att.Size); err != nil {
+			return err
+		}
+		return tx.Create(&att).Error
+	})
+	if errors.Is(err, upload.ErrQuotaExceeded) {
+		failUpload(c, err)
+		return
+	}
+	if err != nil {
+		logger.Error(c, "保存附件失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	// Content-Length 浏览器会按请求体自动设置，只要文件大小和声明的一致即可
+	ttl := h.svc.Config.Upload.PresignTTL
+	req, err := h.svc.Storage.PresignPut(c.Request.Context(), att.Key, att.MimeType, att.Size, ttl)
+	if err != nil {
+		logger.Error(c, "生成直传地址失败", "key", att.Key, "error", err.Error())
+		h.svc.DB.Delete(&att)
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+
+	logger.Info(c, "upload_presigned", "user_id", user.ID, "attachment_id", att.ID, "key", att.Key, "size", att.Size)
+	response.Success(c, gin.H{
+		"attachmentId": att.ID,
+		"key":          att.Key,
+		"upload":       req,
+		"expiresAt":    time.Now().Add(ttl),
+	})
+}
+
+// POST /upload/complete
+// 直传完成的回调：确认对象存在、大小一致、内容嗅探结果与声明的类型一致，然后登记附件
+// 不一致时删除对象和记录，客户端需要重新申请直传地址
+func (h *UploadHandler) Complete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input struct {
+		AttachmentID uint `json:"attachmentId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeInvalidParam, apperr.GetMsg(apperr.CodeInvalidParam))
+		return
+	}
+
+	var att models.Attachment
+	if err := h.svc.DB.Where("\"ownerId\" = ?", convertToUint(userID)).First(&att, input.AttachmentID).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeAttachmentNotExist, apperr.GetMsg(apperr.CodeAttachmentNotExist))
+		return
+	}
+	if att.Status != models.AttachmentUploading {
+		h.respondAttachment(c, att) // 重复回调，直接返回当前状态
+		return
+	}
+
+	// 直传地址过期前客户端还能继续往上传位置写，先复制一份到只有服务端知道的暂存 key，校验和登记都用这份
+	ctx := c.Request.Context()
+	staging := att.Key
+	frozen := blob.StagingKey(path.Ext(staging))
+	err := h.svc.Storage.Copy(ctx, staging, frozen)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.Fail(c, http.StatusBadRequest, apperr.CodeUploadNotFinished, apperr.GetMsg(apperr.CodeUploadNotFinished))
+		return
+	}
+	if err != nil {
+		logger.Error(c, "复制对象失败", "key", staging, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	defer h.deleteObject(c, frozen)
+
+	size, contentType, checksum, err := h.inspectObject(ctx, frozen)
+	if err != nil {
+		logger.Error(c, "读取对象失败", "key", frozen, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	if size != att.Size || contentType != att.MimeType {
+		logger.Info(c, "upload_rejected", "attachment_id", att.ID, "key", staging,
+			"declared_size", att.Size, "size", size, "declared_type", att.MimeType, "content_type", contentType)
+		h.deleteObject(c, staging)
+		h.svc.DB.Delete(&att)
+		response.Fail(c, http.StatusUnprocessableEntity, apperr.CodeFileNotAsDeclared, apperr.GetMsg(apperr.CodeFileNotAsDeclared))
+		return
+	}
+
+	// 只有仍然是 uploading 的记录才登记，并发的重复回调只会处理一次
+	// 附件改为指向按内容寻址的 key；相同内容已经存在时不用复制
+	key := blob.Key(checksum, path.Ext(staging))
+	b := models.Blob{
+		Key:      key,
+		Checksum: checksum,
+		Size:     size,
+		MimeType: att.MimeType,
+		Status:   models.BlobStoring,
+	}
+	var registered, fresh bool
+	err = h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Attachment{}).Where("id = ? AND status = ?", att.ID, models.AttachmentUploading).
+			Updates(map[string]interface{}{"status": models.AttachmentReady, "key": key, "checksum": checksum})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		registered = true
+		var err error
+		fresh, err = blob.Acquire(tx, &b)
+		return err
+	})
+	if errors.Is(err, blob.ErrDeleting) {
+		failUpload(c, err) // 附件还是 uploading，客户端稍后重新回调即可
+		return
+	}
+	if err != nil {
+		logger.Error(c, "登记附件失败", "attachment_id", att.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	if !registered {
+		if err := h.svc.DB.First(&att, att.ID).Error; err != nil {
+			response.Fail(c, http.StatusNotFound, apperr.CodeAttachmentNotExist, apperr.GetMsg(apperr.CodeAttachmentNotExist))
+			return
+		}
+		h.respondAttachment(c, att)
+		return
+	}
+
+	// 第一次出现的内容：从校验过的副本复制到 Blob 的位置；失败时附件退回 uploading，客户端可以重新回调
+	if fresh {
+		err := h.storeBlob(ctx, &b, frozen, func(tx *gorm.DB) error {
+			return tx.Model(&models.Attachment{}).Where("id = ?", att.ID).
+				Updates(map[string]interface{}{"status": models.AttachmentUploading, "key": staging, "checksum": ""}).Error
+		})
+		if err != nil {
+			logger.Error(c, "登记附件失败", "attachment_id", att.ID, "error", err.Error())
+			response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+			return
+		}
+	}
+
+	// 上传位置已经没有记录引用，删除失败也不会被访问到 (清理任务会删掉过期的暂存对象)
+	h.deleteObject(c, staging)
+	att.Status, att.Key, att.Checksum = models.AttachmentReady, key, checksum
+
+	logger.Info(c, "file_uploaded", "user_id", att.OwnerID, "attachment_id", att.ID, "key", att.Key, "size", att.Size, "content_type", att.MimeType, "direct", true, "deduplicated", !fresh)
+	response.Success(c, newAttachmentView(att, &b))
+}
+
+// respondAttachment 查询附件引用的 Blob 后返回
+func (h *UploadHandler) respondAttachment(c *gin.Context, att models.Attachment) {
+	view, err := loadAttachmentView(h.svc.DB, att)
+	if err != nil {
+		logger.Error(c, "查询附件失败", "attachment_id", att.ID, "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+		return
+	}
+	response.Success(c, view)
+}
+
+func (h *UploadHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, _ := c.Get("userID")
+
+	var user models.User
+	if err := h.svc.DB.First(&user, convertToUint(userID)).Error; err != nil {
+		response.Fail(c, http.StatusNotFound, apperr.CodeUserNotFound, apperr.GetMsg(apperr.CodeUserNotFound))
+		return nil, false
+	}
+	return &user, true
+}
+
+// reserveQuota 锁住用户行再统计用量 (需要传入事务)
+// 同一个用户的并发上传在这里排队，不会一起通过检查后超额
+func (h *UploadHandler) reserveQuota(tx *gorm.DB, user *models.User, size int64) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, user.ID).Error; err != nil {
+		return err
+	}
+	usage, err := attachmentUsage(tx, user.ID)
+	if err != nil {
+		return err
+	}
+	return h.policy.Quota(user.IsPro).Allow(usage, size)
+}
+
+// inspectObject 读一遍对象：返回大小，用开头嗅探真实类型，同时计算 SHA-256
+// 直传的文件不经过 API，只能在登记时从存储读回来 (走内网，比客户端上传快得多)
+func (h *UploadHandler) inspectObject(ctx context.Context, key string) (int64, string, string, error) {
+	body, info, err := h.svc.Storage.Get(ctx, key)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	contentType, err := upload.Sniff(io.TeeReader(body, hasher))
+	if errors.Is(err, upload.ErrEmptyFile) {
+		return info.Size, "", "", nil
+	}
 	if err != nil {
-		response.Fail(c, http.StatusInternalServerError, 50001, "Storage init failed")
+		return 0, "", "", err
+	}
+	if _, err := io.Copy(hasher, body); err != nil {
+		return 0, "", "", err
+	}
+	return info.Size, contentType, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// deleteObject 尽力删除，失败只记日志 (对象没有记录引用，不会被访问到)
+func (h *UploadHandler) deleteObject(c *gin.Context, key string) {
+	if err := h.svc.Storage.Delete(c.Request.Context(), key); err != nil {
+		logger.Error(c, "删除对象失败", "key", key, "error", err.Error())
+	}
+}
+
+// storeBlob 把暂存对象复制到新建 Blob 的位置，再用短事务把 storing 转为 pending/ready (图片同时写处理消息进 Outbox)
+// 复制失败时调用 undo 撤销这次上传的附件，见 abandonBlob
+func (h *UploadHandler) storeBlob(ctx context.Context, b *models.Blob, src string, undo func(tx *gorm.DB) error) error {
+	dst := blob.WriteKey(b)
+	if err := h.svc.Storage.Copy(ctx, src, dst); err != nil {
+		return errors.Join(err, h.abandonBlob(b, err, undo))
+	}
+
+	status := blob.InitialStatus(b.MimeType)
+	var stored bool
+	err := h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Blob{}).Where("key = ? AND status = ?", b.Key, models.BlobStoring).Update("status", status)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		stored, b.Status = true, status
+		return enqueueProcessing(ctx, tx, b)
+	})
+	if err != nil || stored {
+		return err
+	}
+	// 复制期间记录已经被清理，刚写的对象没有记录引用
+	return errors.Join(errors.New("blob removed while storing"), h.svc.Storage.Delete(ctx, dst))
+}
+
+// abandonBlob 复制失败：撤销附件并释放引用 (复制是原子的，目标位置不会留下写了一半的对象)
+// 没有别的附件引用时连记录一起删掉，同样内容的下一次上传按新对象写入；同样内容的并发上传已经引用了它时只能标记为 failed
+func (h *UploadHandler) abandonBlob(b *models.Blob, cause error, undo func(tx *gorm.DB) error) error {
+	return h.svc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := undo(tx); err != nil {
+			return err
+		}
+		if err := blob.Release(tx, b.Key); err != nil {
+			return err
+		}
+		res := tx.Where(`key = ? AND status = ? AND "refCount" = 0`, b.Key, models.BlobStoring).Delete(&models.Blob{})
+		if res.Error != nil || res.RowsAffected > 0 {
+			return res.Error
+		}
+		return tx.Model(&models.Blob{}).Where("key = ? AND status = ?", b.Key, models.BlobStoring).
+			Updates(map[string]interface{}{"status": models.BlobFailed, "processError": cause.Error()}).Error
+	})
+}
+
+// enqueueProcessing 图片写一条处理消息进 Outbox (需要传入事务)
+func enqueueProcessing(ctx context.Context, tx *gorm.DB, b *models.Blob) error {
+	if b.Status != models.BlobPending {
+		return nil
+	}
+	return mq.PublishImageUploaded(ctx, outbox.NewWriter(tx), b.Key)
+}
+
+// failUpload 把校验错误映射成对应的业务码
+func failUpload(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, upload.ErrEmptyFile):
+		response.Fail(c, http.StatusBadRequest, apperr.CodeFileEmpty, apperr.GetMsg(apperr.CodeFileEmpty))
+	case errors.Is(err, upload.ErrTooLarge):
+		response.Fail(c, http.StatusRequestEntityTooLarge, apperr.CodeFileTooLarge, apperr.GetMsg(apperr.CodeFileTooLarge))
+	case errors.Is(err, upload.ErrTypeNotAllowed):
+		response.Fail(c, http.StatusUnsupportedMediaType, apperr.CodeFileTypeNotAllowed, apperr.GetMsg(apperr.CodeFileTypeNotAllowed))
+	case errors.Is(err, upload.ErrQuotaExceeded):
+		response.Fail(c, http.StatusForbidden, apperr.CodeQuotaExceeded, apperr.GetMsg(apperr.CodeQuotaExceeded))
+	case errors.Is(err, upload.ErrExtensionMismatch):
+		response.Fail(c, http.StatusUnsupportedMediaType, apperr.CodeFileExtMismatch, apperr.GetMsg(apperr.CodeFileExtMismatch))
+	case errors.Is(err, blob.ErrDeleting):
+		// 同样内容的旧对象正在被清理，几秒后重试即可
+		response.Fail(c, http.StatusServiceUnavailable, apperr.CodeServiceUnavailable, apperr.GetMsg(apperr.CodeServiceUnavailable))
+	default:
+		logger.Error(c, "读取上传文件失败", "error", err.Error())
+		response.Fail(c, http.StatusInternalServerError, apperr.CodeInternalError, apperr.GetMsg(apperr.CodeInternalError))
+	}
+}
+
+// GET /uploads/*key
+// 只在 STORAGE_DRIVER=local 时注册，代替 Nginx + MinIO 提供文件访问
+// 带 signature 参数时 (PresignGet 生成的地址) 校验签名和过期时间
+func (h *UploadHandler) ServeLocalFile(c *gin.Context) {
+	local, ok := h.svc.Storage.(*storage.LocalBackend)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if storage.IsPrivate(key) {
+		c.Status(http.StatusNotFound)
 		return
 	}
+	if sig := c.Query("signature"); sig != "" {
+		if err := local.VerifyGet(key, c.Query("expires"), sig); err != nil {
+			c.Status(http.StatusForbidden)
+			return
+		}
+	}
 
-	// 3. 上传
-	url, err := s3Service.UploadFile(file, header)
+	body, info, err := local.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		c.Status(http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		response.Fail(c, http.StatusInternalServerError, 50002, "Upload failed")
+		logger.Error(c, "读取文件失败", "key", key, "error", err.Error())
+		c.Status(http.StatusInternalServerError)
 		return
 	}
+	defer body.Close()
 
-	// 4. 返回 URL
-	// 假设我们通过 Nginx 代理了 MinIO，或者直接用 localhost:9000
-	// 生产环境中，这个 baseUrl 应该配置在 env 里
-	finalUrl := fmt.Sprintf("/uploads/%s", url)
-	response.Success(c, gin.H{"url": finalUrl})
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Header("Content-Type", info.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, body)
+}
+
+// PUT /uploads/*key
+// 只在 STORAGE_DRIVER=local 时注册，接收 PresignPut 签发的直传请求 (相当于 MinIO 的预签名 PUT)
+func (h *UploadHandler) ReceiveLocalUpload(c *gin.Context) {
+	local, ok := h.svc.Storage.(*storage.LocalBackend)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	size := c.Request.ContentLength
+	contentType := c.ContentType()
+	if err := local.VerifyPut(key, contentType, size, c.Query("expires"), c.Query("signature")); err != nil {
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, size)
+	if err := local.Put(c.Request.Context(), key, body, size, contentType); err != nil {
+		logger.Error(c, "接收直传文件失败", "key", key, "error", err.Error())
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusOK)
 }
@@ -1,38 +1,130 @@
 package mailer
 
 import (
-	"crypto/tls"
-	"fmt"
 	"go-api/internal/config"
+	"go-api/internal/pkg/unsubscribe"
+	"net/url"
 
 	"gopkg.in/gomail.v2"
 )
 
-func SendPostNotification(cfg config.MailConfig, toEmail, title string, postURL string) error {
-	m := gomail.NewMessage()
-	m.SetHeader("From", cfg.From)
-	m.SetHeader("To", toEmail)
-	m.SetHeader("Subject", "新帖发布通知: "+title)
-
-	body := fmt.Sprintf(`
-		<p>Hi there,</p>
-		<p>Go后端通知您，有新帖子发布了：<b>%s</b></p>
-		<p><a href="%s">点击查看</a></p>
-	`, title, postURL)
-
-	m.SetBody("text/html", body)
-
-	// 如果是 Mailhog (通常端口 1025)，或者没配密码，就不走认证
-	// gomail.NewDialer 如果 user/pass 为空，就不会触发 PlainAuth，也就不会报 "unencrypted connection"
-	var d *gomail.Dialer
-	if cfg.Port == 1025 || cfg.Pass == "" {
-		d = gomail.NewDialer(cfg.Host, cfg.Port, "", "")
-	} else {
-		d = gomail.NewDialer(cfg.Host, cfg.Port, cfg.User, cfg.Pass)
+// 各个模板用到的数据
+
+type PostNotificationData struct {
+	Title   string
+	PostURL string
+}
+
+type VerifyEmailData struct {
+	VerifyURL string
+}
+
+type PasswordResetData struct {
+	ResetURL string
+}
+
+// DigestData 摘要邮件
+type DigestData struct {
+	Weekly      bool         // 每周摘要，否则是每日
+	Total       int          // 这段时间内的新帖总数
+	Posts       []DigestPost // 列出的帖子 (最多 DigestConfig.MaxPosts 篇)
+	More        int          // 没有列出的帖子数
+	ForumURL    string
+	SettingsURL string
+}
+
+type DigestPost struct {
+	Title     string
+	URL       string
+	CreatedAt string // 已经格式化好的时间
+}
+
+// Mailer 渲染模板并通过 Sender 发信
+type Mailer struct {
+	sender Sender
+	from   string
+
+	// 通知类邮件的退订链接：<unsubscribeURL>?token=<签名令牌>
+	unsubscribeURL string
+	signer         *unsubscribe.Signer
+}
+
+// New 按配置创建 Mailer (发送通道由 MAIL_TRANSPORT 决定)
+func New(cfg config.MailConfig) (*Mailer, error) {
+	sender, err := NewSender(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m := NewWithSender(sender, cfg.From)
+	m.unsubscribeURL = cfg.UnsubscribeURL
+	m.signer = unsubscribe.NewSigner(cfg.UnsubscribeSecret)
+	return m, nil
+}
+
+// NewWithSender 指定发送通道，测试里可以传 MemorySender (不带退订链接)
+func NewWithSender(sender Sender, from string) *Mailer {
+	return &Mailer{sender: sender, from: from}
+}
+
+// SendPostNotification 订阅的作者/论坛有新帖
+func (m *Mailer) SendPostNotification(userID uint, toEmail, locale, title, postURL string) error {
+	return m.sendTemplate(userID, toEmail, TemplatePostCreated, locale, PostNotificationData{Title: title, PostURL: postURL})
+}
+
+// SendCommentNotification 通知帖子作者有新评论
+func (m *Mailer) SendCommentNotification(userID uint, toEmail, locale, title, postURL string) error {
+	return m.sendTemplate(userID, toEmail, TemplatePostCommented, locale, PostNotificationData{Title: title, PostURL: postURL})
+}
+
+// SendVerificationEmail 注册后的邮箱验证邮件
+func (m *Mailer) SendVerificationEmail(toEmail, locale, verifyURL string) error {
+	return m.sendTemplate(0, toEmail, TemplateVerifyEmail, locale, VerifyEmailData{VerifyURL: verifyURL})
+}
+
+// SendPasswordResetEmail 重置密码邮件
+func (m *Mailer) SendPasswordResetEmail(toEmail, locale, resetURL string) error {
+	return m.sendTemplate(0, toEmail, TemplatePasswordReset, locale, PasswordResetData{ResetURL: resetURL})
+}
+
+// SendDigest 每日/每周新帖摘要
+func (m *Mailer) SendDigest(userID uint, toEmail, locale string, data DigestData) error {
+	return m.sendTemplate(userID, toEmail, TemplateDigest, locale, data)
+}
+
+// sendTemplate 渲染模板并以 multipart/alternative (纯文本 + HTML) 发送
+// 通知类邮件会带上退订链接和 RFC 8058 的一键退订头
+func (m *Mailer) sendTemplate(userID uint, toEmail, name, locale string, data interface{}) error {
+	unsubscribeURL := m.unsubscribeLink(userID, name)
+
+	rendered, err := Render(name, locale, data, unsubscribeURL)
+	if err != nil {
+		return err
+	}
+
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", m.from)
+	msg.SetHeader("To", toEmail)
+	msg.SetHeader("Subject", rendered.Subject)
+	if unsubscribeURL != "" {
+		// 邮件客户端会向这个地址 POST "List-Unsubscribe=One-Click"
+		msg.SetHeader("List-Unsubscribe", "<"+unsubscribeURL+">")
+		msg.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
 	}
+	msg.SetBody("text/plain", rendered.Text)
+	msg.AddAlternative("text/html", rendered.HTML)
 
-	// 允许跳过 TLS 验证 (针对自签名证书的真实 SMTP，对 Mailhog 其实没用因为根本没 TLS)
-	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	return m.sender.Send(msg)
+}
+
+// unsubscribeLink 通知类邮件的退订链接，事务邮件或者没配置退订时返回空
+func (m *Mailer) unsubscribeLink(userID uint, name string) string {
+	if m.signer == nil || m.unsubscribeURL == "" || userID == 0 || !IsNotification(name) {
+		return ""
+	}
+	return m.unsubscribeURL + "?token=" + url.QueryEscape(m.signer.Sign(userID))
+}
 
-	return d.DialAndSend(m)
+// Close 关闭发送通道 (SMTP 连接池)
+func (m *Mailer) Close() error {
+	return m.sender.Close()
 }
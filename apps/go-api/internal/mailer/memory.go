@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"bytes"
+	"sync"
+
+	"gopkg.in/gomail.v2"
+)
+
+// SentMessage 内存通道里保存的一封邮件
+type SentMessage struct {
+	From    string
+	To      []string
+	Subject string
+	Raw     []byte // 完整的 MIME 内容
+}
+
+// MemorySender 只把邮件存在内存里，测试里用来断言发了什么
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []SentMessage
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(m *gomail.Message) error {
+	from, to, err := envelope(m)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	subject := ""
+	if v := m.GetHeader("Subject"); len(v) > 0 {
+		subject = v[0]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, SentMessage{From: from, To: to, Subject: subject, Raw: buf.Bytes()})
+	return nil
+}
+
+// Messages 已发送的邮件 (按发送顺序)
+func (s *MemorySender) Messages() []SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SentMessage(nil), s.messages...)
+}
+
+// Reset 清空已发送的邮件
+func (s *MemorySender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
+
+func (s *MemorySender) Close() error {
+	return nil
+}
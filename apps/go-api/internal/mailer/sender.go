@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"fmt"
+
+	"go-api/internal/config"
+
+	"gopkg.in/gomail.v2"
+)
+
+// 发信方式 (MAIL_TRANSPORT)
+const (
+	TransportSMTP   = "smtp"   // 真实 SMTP 服务器 (Mailhog 也算)
+	TransportFile   = "file"   // 写成 .eml 文件，本地开发用邮件客户端直接打开
+	TransportMemory = "memory" // 只存在内存里，测试用
+)
+
+// Sender 邮件发送通道
+type Sender interface {
+	Send(m *gomail.Message) error
+	Close() error
+}
+
+// NewSender 按配置创建发送通道
+func NewSender(cfg config.MailConfig) (Sender, error) {
+	switch cfg.Transport {
+	case TransportSMTP, "":
+		return NewSMTPSender(cfg)
+	case TransportFile:
+		return NewFileSender(cfg.FileDir)
+	case TransportMemory:
+		return NewMemorySender(), nil
+	default:
+		return nil, fmt.Errorf("mailer: unknown transport %q", cfg.Transport)
+	}
+}
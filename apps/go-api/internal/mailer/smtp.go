@@ -0,0 +1,285 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"go-api/internal/config"
+
+	"gopkg.in/gomail.v2"
+)
+
+// TLS 模式 (MAIL_TLS)
+const (
+	TLSNone     = "none"     // 明文，只适合本机的 Mailhog 之类
+	TLSStartTLS = "starttls" // 明文连接后升级 (一般是 587 端口)，服务器不支持时直接报错，不会降级
+	TLSImplicit = "tls"      // 一开始就是 TLS (一般是 465 端口)
+)
+
+const (
+	smtpDialTimeout    = 10 * time.Second
+	defaultSendTimeout = 30 * time.Second
+)
+
+var errSMTPClosed = errors.New("mailer: smtp sender closed")
+
+// SMTPSender 带连接池的 SMTP 发送
+// 连接用完放回池子复用，空闲超过 IdleTimeout 的连接会被丢弃重连 (服务器一般会主动断开空闲连接)
+// 每次发信前给连接设置 SendTimeout 的读写期限，服务器卡住时不会一直占着连接池
+type SMTPSender struct {
+	cfg       config.MailConfig
+	addr      string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	slots chan struct{}    // 限制同时打开的连接数
+	idle  chan *pooledConn // 空闲连接
+	done  chan struct{}
+}
+
+type pooledConn struct {
+	conn     net.Conn // 底层 TCP 连接，用来设置读写期限 (STARTTLS 之后同样有效)
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+func NewSMTPSender(cfg config.MailConfig) (*SMTPSender, error) {
+	switch cfg.TLS {
+	case TLSNone, TLSStartTLS, TLSImplicit:
+	default:
+		return nil, fmt.Errorf("mailer: unknown tls mode %q", cfg.TLS)
+	}
+
+	size := cfg.PoolSize
+	if size <= 0 {
+		size = 1
+	}
+	timeout := cfg.SendTimeout
+	if timeout <= 0 {
+		timeout = defaultSendTimeout
+	}
+	return &SMTPSender{
+		cfg:  cfg,
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		// 证书按 Host 校验，自签名证书请把 CA 加到系统信任列表，而不是跳过校验
+		tlsConfig: &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12},
+		timeout:   timeout,
+		slots:     make(chan struct{}, size),
+		idle:      make(chan *pooledConn, size),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Send 从池子里取一个连接发信；复用的连接如果已经失效，换一个新连接重试一次
+// 超时的连接直接丢弃，不重试 (服务器可能已经收下了邮件，只是没来得及响应)
+func (s *SMTPSender) Send(m *gomail.Message) error {
+	from, to, err := envelope(m)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	case <-s.done:
+		return errSMTPClosed
+	}
+	defer func() { <-s.slots }()
+
+	pc, reused, err := s.get()
+	if err != nil {
+		return err
+	}
+
+	err = s.send(pc, from, to, m)
+	if err != nil && reused && !isTimeout(err) {
+		pc.client.Close()
+		if pc, err = s.dial(); err != nil {
+			return err
+		}
+		err = s.send(pc, from, to, m)
+	}
+	if err != nil {
+		pc.client.Close()
+		return err
+	}
+
+	// 清空会话状态，连接可以继续发下一封；这时邮件已经投递成功了，失败只丢弃连接，不能返回错误导致重发
+	if err := pc.client.Reset(); err != nil {
+		pc.client.Close()
+		return nil
+	}
+	s.put(pc)
+	return nil
+}
+
+func (s *SMTPSender) send(pc *pooledConn, from string, to []string, m *gomail.Message) error {
+	if err := pc.conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return err
+	}
+	c := pc.client
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := m.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// get 优先复用空闲连接，没有就新建
+func (s *SMTPSender) get() (*pooledConn, bool, error) {
+	for {
+		select {
+		case pc := <-s.idle:
+			if time.Since(pc.lastUsed) > s.cfg.IdleTimeout {
+				pc.client.Close()
+				continue
+			}
+			return pc, true, nil
+		default:
+			pc, err := s.dial()
+			return pc, false, err
+		}
+	}
+}
+
+func (s *SMTPSender) put(pc *pooledConn) {
+	pc.lastUsed = time.Now()
+	select {
+	case <-s.done:
+		s.quit(pc)
+		return
+	default:
+	}
+	select {
+	case s.idle <- pc:
+	default:
+		s.quit(pc)
+	}
+}
+
+// quit 发 QUIT 关闭连接，失败时直接断开 (Quit 出错时不会关闭底层连接)
+func (s *SMTPSender) quit(pc *pooledConn) {
+	pc.conn.SetDeadline(time.Now().Add(s.timeout))
+	if err := pc.client.Quit(); err != nil {
+		pc.client.Close()
+	}
+}
+
+// dial 建立连接，按 TLS 模式加密，有用户名时做认证
+func (s *SMTPSender) dial() (*pooledConn, error) {
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 握手 (问候、STARTTLS、认证) 也算在超时里
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, errors.New("mailer: smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(s.tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	// net/smtp 的 PlainAuth 会拒绝在非本机的明文连接上发送密码
+	if s.cfg.User != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.User, s.cfg.Pass, s.cfg.Host)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return &pooledConn{conn: conn, client: c, lastUsed: time.Now()}, nil
+}
+
+// Close 关闭所有空闲连接，正在使用的连接发完后也会关闭
+func (s *SMTPSender) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+	for {
+		select {
+		case pc := <-s.idle:
+			s.quit(pc)
+		default:
+			return nil
+		}
+	}
+}
+
+// isTimeout 是否是读写超时
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// envelope 从邮件头里取出信封的发件人和收件人 (To / Cc / Bcc)
+func envelope(m *gomail.Message) (string, []string, error) {
+	from := m.GetHeader("Sender")
+	if len(from) == 0 {
+		from = m.GetHeader("From")
+	}
+	if len(from) == 0 {
+		return "", nil, errors.New(`mailer: missing "From" header`)
+	}
+	fromAddr, err := mail.ParseAddress(from[0])
+	if err != nil {
+		return "", nil, err
+	}
+
+	var to []string
+	for _, field := range []string{"To", "Cc", "Bcc"} {
+		for _, raw := range m.GetHeader(field) {
+			addr, err := mail.ParseAddress(raw)
+			if err != nil {
+				return "", nil, err
+			}
+			to = append(to, addr.Address)
+		}
+	}
+	if len(to) == 0 {
+		return "", nil, errors.New("mailer: no recipients")
+	}
+	return fromAddr.Address, to, nil
+}
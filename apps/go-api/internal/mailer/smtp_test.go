@@ -0,0 +1,306 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-api/internal/config"
+
+	"gopkg.in/gomail.v2"
+)
+
+// fakeSMTP 最小的 SMTP 服务器，只实现 net/smtp 客户端用到的命令
+type fakeSMTP struct {
+	ln net.Listener
+
+	tlsConfig   *tls.Config // 不为空时宣告并支持 STARTTLS
+	rejectRcpt  string      // 拒收这个地址 (550)
+	stallData   bool        // 收完邮件内容后不响应，模拟服务器卡住
+	dropAfterOK bool        // 每封邮件投递成功后直接断开，模拟服务器回收空闲连接
+
+	mu       sync.Mutex
+	conns    int
+	messages int
+}
+
+// newFakeSMTP 启动服务器；implicitTLS 为 true 时整个连接都是 TLS
+func newFakeSMTP(t *testing.T, tlsConfig *tls.Config, implicitTLS bool) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if implicitTLS {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	f := &fakeSMTP{ln: ln}
+	if !implicitTLS {
+		f.tlsConfig = tlsConfig
+	}
+	t.Cleanup(func() { ln.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeSMTP) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns++
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch verb {
+		case "EHLO":
+			if _, upgraded := conn.(*tls.Conn); f.tlsConfig != nil && !upgraded {
+				tp.PrintfLine("250-fake\r\n250 STARTTLS")
+			} else {
+				tp.PrintfLine("250 fake")
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			conn = tls.Server(conn, f.tlsConfig)
+			tp = textproto.NewConn(conn)
+		case "MAIL", "RSET", "NOOP":
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			if f.rejectRcpt != "" && strings.Contains(line, f.rejectRcpt) {
+				tp.PrintfLine("550 no such user")
+			} else {
+				tp.PrintfLine("250 ok")
+			}
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			if _, err := tp.ReadDotBytes(); err != nil {
+				return
+			}
+			f.mu.Lock()
+			stall := f.stallData
+			if !stall {
+				f.messages++
+			}
+			f.mu.Unlock()
+			if stall {
+				time.Sleep(time.Second)
+				return
+			}
+			tp.PrintfLine("250 queued")
+			if f.dropAfterOK {
+				return
+			}
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (f *fakeSMTP) stats() (conns, messages int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns, f.messages
+}
+
+func (f *fakeSMTP) config(tlsMode string) config.MailConfig {
+	host, port, _ := net.SplitHostPort(f.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return config.MailConfig{
+		Host:        host,
+		Port:        p,
+		TLS:         tlsMode,
+		PoolSize:    1,
+		IdleTimeout: time.Minute,
+		SendTimeout: time.Second,
+	}
+}
+
+// testTLS httptest 自带的证书 (签发给 127.0.0.1)，客户端信任它
+func testTLS(t *testing.T) (server *tls.Config, roots *x509.CertPool) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	roots = x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	return &tls.Config{Certificates: srv.TLS.Certificates}, roots
+}
+
+func testMessage(to string) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("From", "no-reply@forum.local")
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "hello")
+	m.SetBody("text/plain", "hello")
+	return m
+}
+
+func TestSMTPSenderReusesConnection(t *testing.T) {
+	f := newFakeSMTP(t, nil, false)
+	s, err := NewSMTPSender(f.config(TLSNone))
+	if err != nil {
+		t.Fatalf("NewSMTPSender: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := s.Send(testMessage("a@example.com")); err != nil {
+			t.Fatalf("Send #%d: %v", i, err)
+		}
+	}
+	if conns, messages := f.stats(); conns != 1 || messages != 3 {
+		t.Fatalf("conns = %d, messages = %d; want 1, 3", conns, messages)
+	}
+}
+
+func TestSMTPSenderEvictsConnection(t *testing.T) {
+	tests := []struct {
+		name         string
+		setup        func(f *fakeSMTP, cfg *config.MailConfig)
+		firstTo      string
+		wantFirstErr bool
+		wantConns    int
+		wantMessages int
+	}{
+		{
+			name:         "rejected recipient drops the connection",
+			setup:        func(f *fakeSMTP, cfg *config.MailConfig) { f.rejectRcpt = "bad@" },
+			firstTo:      "bad@example.com",
+			wantFirstErr: true,
+			wantConns:    2,
+			wantMessages: 1,
+		},
+		{
+			name:         "idle connection is not reused",
+			setup:        func(f *fakeSMTP, cfg *config.MailConfig) { cfg.IdleTimeout = time.Nanosecond },
+			firstTo:      "a@example.com",
+			wantConns:    2,
+			wantMessages: 2,
+		},
+		{
+			name:         "stale pooled connection is redialed",
+			setup:        func(f *fakeSMTP, cfg *config.MailConfig) { f.dropAfterOK = true },
+			firstTo:      "a@example.com",
+			wantConns:    2,
+			wantMessages: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSMTP(t, nil, false)
+			cfg := f.config(TLSNone)
+			tt.setup(f, &cfg)
+			s, err := NewSMTPSender(cfg)
+			if err != nil {
+				t.Fatalf("NewSMTPSender: %v", err)
+			}
+			defer s.Close()
+
+			if err := s.Send(testMessage(tt.firstTo)); (err != nil) != tt.wantFirstErr {
+				t.Fatalf("first Send err = %v, want error %v", err, tt.wantFirstErr)
+			}
+			if err := s.Send(testMessage("a@example.com")); err != nil {
+				t.Fatalf("second Send: %v", err)
+			}
+			if conns, messages := f.stats(); conns != tt.wantConns || messages != tt.wantMessages {
+				t.Fatalf("conns = %d, messages = %d; want %d, %d", conns, messages, tt.wantConns, tt.wantMessages)
+			}
+		})
+	}
+}
+
+// 服务器卡住时 Send 在 SendTimeout 之后返回，连接被丢弃，下一封用新连接
+func TestSMTPSenderTimeout(t *testing.T) {
+	f := newFakeSMTP(t, nil, false)
+	f.stallData = true
+	cfg := f.config(TLSNone)
+	cfg.SendTimeout = 100 * time.Millisecond
+	s, err := NewSMTPSender(cfg)
+	if err != nil {
+		t.Fatalf("NewSMTPSender: %v", err)
+	}
+	defer s.Close()
+
+	start := time.Now()
+	err = s.Send(testMessage("a@example.com"))
+	if !isTimeout(err) {
+		t.Fatalf("Send = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Send took %v, want about %v", elapsed, cfg.SendTimeout)
+	}
+
+	f.mu.Lock()
+	f.stallData = false
+	f.mu.Unlock()
+	if err := s.Send(testMessage("a@example.com")); err != nil {
+		t.Fatalf("Send after timeout: %v", err)
+	}
+	if conns, _ := f.stats(); conns != 2 {
+		t.Fatalf("conns = %d, want 2 (timed out connection must not be reused)", conns)
+	}
+}
+
+func TestSMTPSenderTLSMode(t *testing.T) {
+	serverTLS, roots := testTLS(t)
+
+	tests := []struct {
+		name        string
+		mode        string
+		serverTLS   *tls.Config // 服务器支持 STARTTLS
+		implicitTLS bool        // 服务器整个连接都是 TLS
+		wantErr     bool
+	}{
+		{"none", TLSNone, nil, false, false},
+		{"starttls", TLSStartTLS, serverTLS, false, false},
+		{"starttls not offered, no downgrade", TLSStartTLS, nil, false, true},
+		{"implicit tls", TLSImplicit, serverTLS, true, false},
+		{"implicit tls against plaintext server", TLSImplicit, nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSMTP(t, tt.serverTLS, tt.implicitTLS)
+			s, err := NewSMTPSender(f.config(tt.mode))
+			if err != nil {
+				t.Fatalf("NewSMTPSender: %v", err)
+			}
+			defer s.Close()
+			s.tlsConfig.RootCAs = roots
+
+			err = s.Send(testMessage("a@example.com"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewSMTPSenderUnknownTLSMode(t *testing.T) {
+	if _, err := NewSMTPSender(config.MailConfig{TLS: "ssl"}); err == nil {
+		t.Fatal("NewSMTPSender with unknown tls mode returned nil error")
+	}
+}
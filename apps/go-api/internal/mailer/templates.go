@@ -0,0 +1,228 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// 支持的语言，找不到对应语言的模板时回退到 DefaultLocale
+const (
+	LocaleZH      = "zh"
+	LocaleEN      = "en"
+	DefaultLocale = LocaleZH
+)
+
+// 邮件模板名，对应 templates/<locale>/<name>.{html,txt}.tmpl
+const (
+	TemplatePostCreated   = "post_created"
+	TemplatePostCommented = "post_commented"
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+	TemplateDigest        = "digest"
+)
+
+// ErrTemplateNotFound 模板不存在 (任何语言都没有)
+var ErrTemplateNotFound = errors.New("mailer: template not found")
+
+// Rendered 渲染好的邮件内容，HTML 和纯文本一起作为 multipart/alternative 发送
+type Rendered struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// view 传给模板的数据，模板里通过 .Data 访问具体邮件的字段
+type view struct {
+	Locale         string
+	Subject        string
+	UnsubscribeURL string // 通知类邮件的退订链接，页脚里展示；为空时不展示
+	Data           interface{}
+}
+
+// Registry 邮件模板注册表
+//
+// 目录结构：
+//
+//	templates/layout.{html,txt}.tmpl          公共布局，定义 "layout"
+//	templates/<locale>/partials.{html,txt}.tmpl 各语言的公共片段 ("greeting"、"footer")
+//	templates/<locale>/<name>.html.tmpl       邮件正文，定义 "content"
+//	templates/<locale>/<name>.txt.tmpl        定义 "subject" 和纯文本的 "content"
+//
+// 标题只从纯文本模板里取，避免 html/template 把标题里的特殊字符转义成实体
+type Registry struct {
+	html map[string]*htmltemplate.Template // key: locale/name
+	text map[string]*texttemplate.Template
+}
+
+// NewRegistry 解析目录下的所有模板，启动时调用，模板有语法错误直接返回 error
+func NewRegistry(fsys fs.FS) (*Registry, error) {
+	r := &Registry{
+		html: make(map[string]*htmltemplate.Template),
+		text: make(map[string]*texttemplate.Template),
+	}
+
+	locales, err := fs.ReadDir(fsys, "templates")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range locales {
+		if !dir.IsDir() {
+			continue
+		}
+		locale := dir.Name()
+
+		files, err := fs.Glob(fsys, "templates/"+locale+"/*.txt.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			name := strings.TrimSuffix(file[strings.LastIndex(file, "/")+1:], ".txt.tmpl")
+			if name == "partials" {
+				continue
+			}
+
+			text, err := texttemplate.ParseFS(fsys, "templates/layout.txt.tmpl", "templates/"+locale+"/partials.txt.tmpl", file)
+			if err != nil {
+				return nil, fmt.Errorf("mailer: parse %s: %w", file, err)
+			}
+			html, err := htmltemplate.ParseFS(fsys, "templates/layout.html.tmpl", "templates/"+locale+"/partials.html.tmpl", "templates/"+locale+"/"+name+".html.tmpl")
+			if err != nil {
+				return nil, fmt.Errorf("mailer: parse %s: %w", name, err)
+			}
+
+			r.text[locale+"/"+name] = text
+			r.html[locale+"/"+name] = html
+		}
+	}
+	return r, nil
+}
+
+// Render 按语言渲染邮件，没有对应语言的模板时回退到默认语言
+// unsubscribeURL 不为空时页脚会带上退订链接
+func (r *Registry) Render(name, locale string, data interface{}, unsubscribeURL string) (*Rendered, error) {
+	key := locale + "/" + name
+	if _, ok := r.text[key]; !ok {
+		locale = DefaultLocale
+		key = locale + "/" + name
+	}
+	text, ok := r.text[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	v := view{Locale: locale, UnsubscribeURL: unsubscribeURL, Data: data}
+
+	var buf bytes.Buffer
+	if err := text.ExecuteTemplate(&buf, "subject", v); err != nil {
+		return nil, err
+	}
+	v.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := text.ExecuteTemplate(&buf, "layout", v); err != nil {
+		return nil, err
+	}
+	plain := buf.String()
+
+	buf.Reset()
+	if err := r.html[key].ExecuteTemplate(&buf, "layout", v); err != nil {
+		return nil, err
+	}
+
+	return &Rendered{Subject: v.Subject, HTML: buf.String(), Text: plain}, nil
+}
+
+// Names 所有模板名 (去重、排序)
+func (r *Registry) Names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for key := range r.text {
+		name := key[strings.Index(key, "/")+1:]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsSupportedLocale 是否是支持的语言
+func IsSupportedLocale(locale string) bool {
+	return locale == LocaleZH || locale == LocaleEN
+}
+
+// 内置模板在包初始化时解析，模板写错了进程直接起不来，不会等到发信时才发现
+var templates = mustNewRegistry()
+
+func mustNewRegistry() *Registry {
+	r, err := NewRegistry(templateFS)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Render 用内置模板渲染
+func Render(name, locale string, data interface{}, unsubscribeURL string) (*Rendered, error) {
+	return templates.Render(name, locale, data, unsubscribeURL)
+}
+
+// 通知类邮件 (用户订阅产生的)，必须带退订链接和 List-Unsubscribe 头
+// 验证邮箱、重置密码这类事务邮件不能退订
+var notificationTemplates = map[string]bool{
+	TemplatePostCreated:   true,
+	TemplatePostCommented: true,
+	TemplateDigest:        true,
+}
+
+// IsNotification 是否是通知类邮件
+func IsNotification(name string) bool {
+	return notificationTemplates[name]
+}
+
+// TemplateNames 内置模板列表
+func TemplateNames() []string {
+	return templates.Names()
+}
+
+// previewData 预览用的示例数据
+var previewData = map[string]interface{}{
+	TemplatePostCreated:   PostNotificationData{Title: "Go 1.25 有哪些新特性？<示例>", PostURL: "https://example.com/posts/1"},
+	TemplatePostCommented: PostNotificationData{Title: "Go 1.25 有哪些新特性？<示例>", PostURL: "https://example.com/posts/1#comment-1"},
+	TemplateVerifyEmail:   VerifyEmailData{VerifyURL: "https://example.com/verify-email?token=preview"},
+	TemplatePasswordReset: PasswordResetData{ResetURL: "https://example.com/reset-password?token=preview"},
+	TemplateDigest: DigestData{
+		Total: 12,
+		Posts: []DigestPost{
+			{Title: "Go 1.25 有哪些新特性？<示例>", URL: "https://example.com/posts/1", CreatedAt: "2026-01-02 09:30"},
+			{Title: "PostgreSQL 的 SKIP LOCKED 用法", URL: "https://example.com/posts/2", CreatedAt: "2026-01-02 14:05"},
+		},
+		More:        10,
+		ForumURL:    "https://example.com",
+		SettingsURL: "https://example.com/settings/notifications",
+	},
+}
+
+// Preview 用示例数据渲染模板，给产品/运营在不发信的情况下预览邮件
+func Preview(name, locale string) (*Rendered, error) {
+	data, ok := previewData[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	unsubscribeURL := ""
+	if IsNotification(name) {
+		unsubscribeURL = "https://example.com/unsubscribe?token=preview"
+	}
+	return Render(name, locale, data, unsubscribeURL)
+}
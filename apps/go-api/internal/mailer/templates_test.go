@@ -0,0 +1,157 @@
+package mailer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var allTemplates = []string{
+	TemplateDigest,
+	TemplatePasswordReset,
+	TemplatePostCommented,
+	TemplatePostCreated,
+	TemplateVerifyEmail,
+}
+
+func TestTemplateNames(t *testing.T) {
+	if got := TemplateNames(); !reflect.DeepEqual(got, allTemplates) {
+		t.Fatalf("TemplateNames() = %v, want %v", got, allTemplates)
+	}
+	// 每个模板每种语言都要有
+	for _, name := range allTemplates {
+		for _, locale := range []string{LocaleZH, LocaleEN} {
+			if _, ok := templates.text[locale+"/"+name]; !ok {
+				t.Errorf("missing text template %s/%s", locale, name)
+			}
+			if _, ok := templates.html[locale+"/"+name]; !ok {
+				t.Errorf("missing html template %s/%s", locale, name)
+			}
+		}
+	}
+}
+
+// 每个模板 × 每种语言都用示例数据渲染一遍
+func TestRender(t *testing.T) {
+	const unsubscribeURL = "https://example.com/unsubscribe?token=abc"
+
+	// 各模板正文里一定会出现的内容 (链接)
+	wantLink := map[string]string{
+		TemplatePostCreated:   "https://example.com/posts/1",
+		TemplatePostCommented: "https://example.com/posts/1#comment-1",
+		TemplateVerifyEmail:   "https://example.com/verify-email?token=preview",
+		TemplatePasswordReset: "https://example.com/reset-password?token=preview",
+		TemplateDigest:        "https://example.com/posts/2",
+	}
+
+	for _, name := range allTemplates {
+		for _, locale := range []string{LocaleZH, LocaleEN} {
+			t.Run(locale+"/"+name, func(t *testing.T) {
+				r, err := Render(name, locale, previewData[name], unsubscribeURL)
+				if err != nil {
+					t.Fatalf("Render: %v", err)
+				}
+				if r.Subject == "" || strings.Contains(r.Subject, "\n") {
+					t.Errorf("Subject = %q, want a single non-empty line", r.Subject)
+				}
+				if !strings.Contains(r.Text, wantLink[name]) {
+					t.Errorf("Text does not contain %q", wantLink[name])
+				}
+				if !strings.Contains(r.HTML, strings.ReplaceAll(wantLink[name], "&", "&amp;")) {
+					t.Errorf("HTML does not contain %q", wantLink[name])
+				}
+				if strings.Contains(r.HTML, "<示例>") {
+					t.Error("HTML contains unescaped user content")
+				}
+				if !strings.Contains(r.Text, unsubscribeURL) {
+					t.Error("Text does not contain the unsubscribe link")
+				}
+			})
+		}
+	}
+}
+
+func TestRenderLocaleFallback(t *testing.T) {
+	want, err := Render(TemplateVerifyEmail, DefaultLocale, previewData[TemplateVerifyEmail], "")
+	if err != nil {
+		t.Fatalf("Render default locale: %v", err)
+	}
+	en, err := Render(TemplateVerifyEmail, LocaleEN, previewData[TemplateVerifyEmail], "")
+	if err != nil {
+		t.Fatalf("Render en: %v", err)
+	}
+	if en.Subject == want.Subject {
+		t.Fatalf("en and %s subjects are identical: %q", DefaultLocale, en.Subject)
+	}
+
+	tests := []struct {
+		name   string
+		locale string
+	}{
+		{"empty locale", ""},
+		{"unsupported locale", "fr"},
+		{"region tag", "en-US"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(TemplateVerifyEmail, tt.locale, previewData[TemplateVerifyEmail], "")
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Render(%q) did not fall back to %s", tt.locale, DefaultLocale)
+			}
+		})
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("no_such_template", LocaleEN, nil, ""); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("Render unknown = %v, want ErrTemplateNotFound", err)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		name            string
+		wantUnsubscribe bool
+		wantErr         error
+	}{
+		{TemplatePostCreated, true, nil},
+		{TemplatePostCommented, true, nil},
+		{TemplateDigest, true, nil},
+		{TemplateVerifyEmail, false, nil},
+		{TemplatePasswordReset, false, nil},
+		{"no_such_template", false, ErrTemplateNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Preview(tt.name, LocaleEN)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Preview err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := strings.Contains(r.Text, "/unsubscribe?token="); got != tt.wantUnsubscribe {
+				t.Errorf("unsubscribe link present = %v, want %v", got, tt.wantUnsubscribe)
+			}
+		})
+	}
+}
+
+func TestNewRegistryParseError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/layout.txt.tmpl":       {Data: []byte(`{{define "layout"}}{{template "content" .}}{{end}}`)},
+		"templates/layout.html.tmpl":      {Data: []byte(`{{define "layout"}}{{template "content" .}}{{end}}`)},
+		"templates/zh/partials.txt.tmpl":  {Data: []byte(``)},
+		"templates/zh/partials.html.tmpl": {Data: []byte(``)},
+		"templates/zh/broken.txt.tmpl":    {Data: []byte(`{{define "content"}}{{.Data.Title}`)},
+		"templates/zh/broken.html.tmpl":   {Data: []byte(`{{define "content"}}{{end}}`)},
+	}
+	if _, err := NewRegistry(fsys); err == nil {
+		t.Fatal("NewRegistry with a broken template returned nil error")
+	}
+}
@@ -1,15 +1,21 @@
 package middleware
 
 import (
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
+
+	"go-api/internal/models"
+	"go-api/internal/pkg/session"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // JWTAuth 身份验证中间件
-func JWTAuth(secret string) gin.HandlerFunc {
+// sessions 不为空时会额外检查吊销名单，已注销的 token 立即失效
+func JWTAuth(secret string, sessions *session.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. 从 Header 提取 Token
 		authHeader := c.GetHeader("Authorization")
@@ -27,11 +33,11 @@ func JWTAuth(secret string) gin.HandlerFunc {
 			return
 		}
 
-		// 2. 解析并校验 Token
+		// 2. 解析并校验 Token (只接受 HS256，防止算法混淆攻击)
 		tokenString := parts[1]
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			return []byte(secret), nil
-		})
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token无效或已过期"})
@@ -39,13 +45,51 @@ func JWTAuth(secret string) gin.HandlerFunc {
 			return
 		}
 
-		// 3. 提取用户信息并存入 Context
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token无效或已过期"})
+			c.Abort()
+			return
+		}
+
+		// 3. 检查吊销名单
+		// sid 只有 Go 签发的 token 才有，NestJS 签发的 token 只受用户级吊销约束
+		sid, _ := claims["sid"].(string)
+		if sessions != nil {
+			var issuedAt time.Time
+			if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+				issuedAt = iat.Time
+			}
+			sub, _ := claims["sub"].(float64)
+
+			revoked, err := sessions.IsRevoked(c.Request.Context(), uint(sub), sid, issuedAt)
+			if err != nil {
+				// 吊销名单查不到时宁可拒绝，也不能放过已注销的 token
+				slog.Error("revocation_check_failed", "err", err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "认证服务暂不可用"})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token已注销"})
+				c.Abort()
+				return
+			}
+		}
+
+		// 4. 提取用户信息并存入 Context
 		// 这里 sub 对应的是 UserID
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			userID := claims["sub"]
-			// 在 Go 里这相当于 ctx.Set("user", user)
-			c.Set("userID", userID)
+		userID := claims["sub"]
+		// 在 Go 里这相当于 ctx.Set("user", user)
+		c.Set("userID", userID)
+		c.Set("sessionID", sid)
+
+		// 角色：NestJS 签发的 token 没有 role，按普通用户处理
+		role, _ := claims["role"].(string)
+		if role == "" {
+			role = models.RoleUser
 		}
+		c.Set("role", role)
 
 		c.Next() // 继续执行后续逻辑
 	}
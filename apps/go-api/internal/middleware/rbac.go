@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"go-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 权限点：路由按权限而不是按角色做限制，新增角色时只需要改 rolePermissions
+const (
+	PermPostModerate = "post:moderate" // 删除/恢复任意帖子
+	PermUserManage   = "user:manage"   // 修改用户角色
+)
+
+var rolePermissions = map[string][]string{
+	models.RoleModerator: {PermPostModerate},
+	models.RoleAdmin:     {PermPostModerate, PermUserManage},
+}
+
+// HasPermission 判断角色是否拥有某个权限
+func HasPermission(role, perm string) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// RequireRole 只允许指定角色访问，必须挂在 JWTAuth 之后
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, c.GetString("role")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission 只允许拥有指定权限的角色访问，必须挂在 JWTAuth 之后
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c.GetString("role"), perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
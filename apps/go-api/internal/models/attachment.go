@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// 附件状态 (图片处理的状态在 Blob 上，同样内容的附件共享)
+const (
+	AttachmentUploading = "uploading" // 已签发直传地址，等客户端上传完成后回调；Key 是临时的上传位置
+	AttachmentReady     = "ready"     // 已登记，Key 指向按内容寻址的 Blob
+	AttachmentDeleting  = "deleting"  // 没登记的直传被删除：先删临时对象再删记录，删对象失败时清理任务会再试
+)
+
+// Attachment 用户上传的文件，每个附件是对一个 Blob 的引用
+// 相同内容上传多次只存一份，但每个附件都按上传的大小计入各自用户的配额
+// PostID 为空的附件是孤儿，超过宽限期 (从 UpdatedAt 算起，取消关联也会刷新它) 后由清理任务删除
+type Attachment struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	OwnerID   uint      `gorm:"column:ownerId;not null;index" json:"ownerId"`
+	Key       string    `gorm:"column:key;type:varchar(255);not null;index" json:"key"`
+	Size      int64     `gorm:"column:size;not null" json:"size"`
+	MimeType  string    `gorm:"column:mimeType;type:varchar(100);not null" json:"mimeType"`
+	Checksum  string    `gorm:"column:checksum;type:varchar(64);not null;default:''" json:"checksum"` // 上传内容的 SHA-256 (hex)
+	PostID    *uint     `gorm:"column:postId;index" json:"postId"`
+	Status    string    `gorm:"column:status;type:varchar(20);not null;default:'ready'" json:"status"`
+	CreatedAt time.Time `gorm:"column:createdAt" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updatedAt" json:"updatedAt"`
+}
+
+func (Attachment) TableName() string {
+	return "Attachment"
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// 审计动作
+const (
+	AuditActionUserRoleChange = "user.role_change"
+	AuditActionPostDelete     = "post.delete"
+	AuditActionPostRestore    = "post.restore"
+	AuditActionDeadLetterPlay = "dead_letter.replay"
+	AuditActionOutboxRequeue  = "outbox.requeue"
+)
+
+// AuditLog 管理操作审计记录 (谁、在什么时候、对什么做了什么)
+// 只增不改，不提供删除接口
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey;column:id" json:"id"`
+	ActorID    uint      `gorm:"column:actorId;not null;index" json:"actorId"`
+	Action     string    `gorm:"column:action;type:varchar(50);not null;index" json:"action"`
+	TargetType string    `gorm:"column:targetType;type:varchar(20);not null" json:"targetType"`
+	TargetID   uint      `gorm:"column:targetId;not null" json:"targetId"`
+	Detail     string    `gorm:"column:detail;type:text" json:"detail"` // JSON，记录变更前后的值
+	Reason     string    `gorm:"column:reason;type:text" json:"reason"`
+	CreatedAt  time.Time `gorm:"column:createdAt" json:"createdAt"`
+}
+
+func (AuditLog) TableName() string {
+	return "AuditLog"
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// 存储对象的处理状态
+const (
+	BlobStoring  = "storing"  // 刚创建，创建它的上传正在把内容复制过来，完成后转为 pending/ready
+	BlobPending  = "pending"  // 已上传，等待图片处理 (原图在私有的 OriginalKey，还不能访问)
+	BlobReady    = "ready"    // 处理完成 (非图片上传后直接是 ready)
+	BlobFailed   = "failed"   // 处理失败，原图已删除，不对外提供
+	BlobDeleting = "deleting" // 没有引用，清理任务正在删除对象；删完对象再删记录，期间不能再被引用
+)
+
+// Blob 按内容寻址的存储对象，Key 由上传内容的 SHA-256 决定，相同内容只存一份
+// 每个引用它的附件计一次 RefCount；减到 0 后不立即删除，由清理任务在宽限期后标记为 deleting，删除对象后再删记录
+// 图片去除元数据后存的字节会变，但同样的上传内容总是得到同一个处理结果，所以 Key 仍然只取决于上传内容
+// 图片的原图先写到私有的 OriginalKey，Key 上只会出现去除元数据后的版本
+// Variants 是图片处理生成的各尺寸 key (thumb/medium/large)，原图比目标尺寸小时直接指向原图
+type Blob struct {
+	Key          string            `gorm:"column:key;type:varchar(255);primaryKey" json:"key"`
+	Checksum     string            `gorm:"column:checksum;type:varchar(64);not null;uniqueIndex" json:"checksum"` // 上传内容的 SHA-256 (hex)
+	Size         int64             `gorm:"column:size;not null" json:"size"`                                      // 实际存储的大小 (图片去除元数据后会变)
+	MimeType     string            `gorm:"column:mimeType;type:varchar(100);not null" json:"mimeType"`
+	RefCount     int               `gorm:"column:refCount;not null;default:0;index" json:"refCount"`
+	Width        int               `gorm:"column:width;not null;default:0" json:"width"`
+	Height       int               `gorm:"column:height;not null;default:0" json:"height"`
+	Status       string            `gorm:"column:status;type:varchar(20);not null;default:'ready'" json:"status"`
+	Variants     map[string]string `gorm:"column:variants;type:text;serializer:json" json:"variants"`
+	ProcessError string            `gorm:"column:processError;type:text" json:"-"`
+	CreatedAt    time.Time         `gorm:"column:createdAt" json:"createdAt"`
+	UpdatedAt    time.Time         `gorm:"column:updatedAt" json:"updatedAt"`
+}
+
+func (Blob) TableName() string {
+	return "Blob"
+}
+
+// OriginalKey 图片原图的私有位置 (private/ 前缀不对外提供)，worker 去除元数据并写到 Key 之后删除
+func (b *Blob) OriginalKey() string {
+	return "private/originals/" + b.Key
+}
+
+// ObjectKeys 对象在存储里的所有 key (处理后的图片/文件 + 缩略图 + 可能还没删掉的原图，去重)
+func (b *Blob) ObjectKeys() []string {
+	keys := []string{b.Key, b.OriginalKey()}
+	for _, k := range b.Variants {
+		if !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Comment 帖子评论，支持楼中楼
+// ParentID 为空表示直接回复帖子的一级评论；RootID 指向所在楼层的一级评论，方便一次取出整棵子树
+type Comment struct {
+	ID       uint   `gorm:"primaryKey;column:id" json:"id"`
+	PostID   uint   `gorm:"column:postId;not null;index:idx_comment_post_created,priority:1" json:"postId"`
+	AuthorID uint   `gorm:"column:authorId;not null" json:"authorId"`
+	ParentID *uint  `gorm:"column:parentId" json:"parentId"`
+	RootID   *uint  `gorm:"column:rootId;index" json:"rootId"`
+	Content  string `gorm:"column:content;type:text;not null" json:"content"`
+
+	CreatedAt time.Time      `gorm:"column:createdAt;index:idx_comment_post_created,priority:2" json:"createdAt"`
+	UpdatedAt time.Time      `gorm:"column:updatedAt" json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"column:deletedAt;index" json:"-"`
+
+	// 以下字段不落库，只用于组装评论树
+	Deleted bool       `gorm:"-" json:"deleted"`
+	Replies []*Comment `gorm:"-" json:"replies"`
+}
+
+// 与 Prisma 的表命名保持一致
+func (Comment) TableName() string {
+	return "Comment"
+}
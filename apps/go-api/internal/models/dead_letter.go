@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// DeadLetter 重试耗尽或无法处理的 MQ 消息，落库后供管理后台查看和重放
+type DeadLetter struct {
+	ID          uint       `gorm:"primaryKey;column:id" json:"id"`
+	Pattern     string     `gorm:"column:pattern;type:varchar(100);index" json:"pattern"`
+	Body        string     `gorm:"column:body;type:text;not null" json:"body"` // 原始消息体，重放时原样投递
+	Error       string     `gorm:"column:error;type:text" json:"error"`
+	Attempts    int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	ReplayCount int        `gorm:"column:replayCount;not null;default:0" json:"replayCount"`
+	ReplayedAt  *time.Time `gorm:"column:replayedAt" json:"replayedAt"`
+	CreatedAt   time.Time  `gorm:"column:createdAt;index" json:"createdAt"`
+}
+
+func (DeadLetter) TableName() string {
+	return "DeadLetter"
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// DigestState 每个用户的摘要邮件投递状态
+// LastSentAt 是上一次摘要覆盖到的时间点，下一次从这里开始收集新帖
+type DigestState struct {
+	UserID        uint       `gorm:"primaryKey;autoIncrement:false;column:userId" json:"userId"`
+	LastSentAt    *time.Time `gorm:"column:lastSentAt" json:"lastSentAt"`
+	LastPostCount int        `gorm:"column:lastPostCount;not null;default:0" json:"lastPostCount"` // 上一次摘要包含的帖子数 (没有新帖时为 0，不发信)
+	Failures      int        `gorm:"column:failures;not null;default:0" json:"failures"`           // 连续失败次数，发送成功后清零
+	LastError     string     `gorm:"column:lastError;type:text" json:"lastError"`
+	NextAttemptAt *time.Time `gorm:"column:nextAttemptAt;index" json:"nextAttemptAt"`              // 领取后是租约到期时间，失败后是退避到的时间；为空表示随时可以发
+	LeaseID       string     `gorm:"column:leaseId;type:varchar(36);not null;default:''" json:"-"` // 领取这一行的批次，写回结果时校验
+	UpdatedAt     time.Time  `gorm:"column:updatedAt" json:"updatedAt"`
+}
+
+func (DigestState) TableName() string {
+	return "DigestState"
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// 邮箱被加入抑制列表的原因
+const (
+	SuppressionUnsubscribe = "unsubscribe" // 用户点了退订链接，只屏蔽通知类邮件
+	SuppressionBounce      = "bounce"      // 硬退信，所有邮件都不再发
+	SuppressionComplaint   = "complaint"   // 被标记为垃圾邮件，所有邮件都不再发
+	SuppressionManual      = "manual"      // 运营手动加入，所有邮件都不再发
+)
+
+// EmailSuppression 邮件抑制列表，worker 发信前检查
+// 邮箱统一存小写
+type EmailSuppression struct {
+	ID        uint      `gorm:"primaryKey;column:id" json:"id"`
+	Email     string    `gorm:"column:email;type:varchar(255);not null;uniqueIndex" json:"email"`
+	Reason    string    `gorm:"column:reason;type:varchar(20);not null" json:"reason"`
+	UserID    *uint     `gorm:"column:userId" json:"userId"`
+	CreatedAt time.Time `gorm:"column:createdAt" json:"createdAt"`
+}
+
+func (EmailSuppression) TableName() string {
+	return "EmailSuppression"
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// PostNotificationBatch 新帖通知扇出出去的批次，(PostID, Batch) 唯一
+// post_created 重复投递时第 0 批已经存在，直接跳过，不会再扇出一遍
+type PostNotificationBatch struct {
+	ID         uint      `gorm:"primaryKey;column:id" json:"id"`
+	PostID     uint      `gorm:"column:postId;not null;uniqueIndex:idx_post_notification_batch,priority:1" json:"postId"`
+	Batch      int       `gorm:"column:batch;not null;uniqueIndex:idx_post_notification_batch,priority:2" json:"batch"`
+	Recipients int       `gorm:"column:recipients;not null" json:"recipients"`
+	CreatedAt  time.Time `gorm:"column:createdAt" json:"createdAt"`
+}
+
+func (PostNotificationBatch) TableName() string {
+	return "PostNotificationBatch"
+}
+
+// PostNotificationDelivery 新帖通知已经发给了谁，(PostID, UserID) 唯一
+// 批次中途失败重试时跳过已经发过的收件人
+type PostNotificationDelivery struct {
+	PostID uint      `gorm:"primaryKey;autoIncrement:false;column:postId" json:"postId"`
+	UserID uint      `gorm:"primaryKey;autoIncrement:false;column:userId" json:"userId"`
+	SentAt time.Time `gorm:"column:sentAt;not null" json:"sentAt"`
+}
+
+func (PostNotificationDelivery) TableName() string {
+	return "PostNotificationDelivery"
+}
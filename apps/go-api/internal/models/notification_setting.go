@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// 新帖通知频率
+const (
+	FrequencyImmediate = "immediate" // 每篇新帖都立即通知
+	FrequencyDaily     = "daily"     // 每日摘要
+	FrequencyWeekly    = "weekly"    // 每周摘要
+	FrequencyOff       = "off"       // 不接收新帖通知
+)
+
+func IsValidFrequency(f string) bool {
+	switch f {
+	case FrequencyImmediate, FrequencyDaily, FrequencyWeekly, FrequencyOff:
+		return true
+	}
+	return false
+}
+
+// NotificationSetting 用户的邮件通知偏好
+// 没有记录的用户按 DefaultNotificationSetting 处理 (全部开启)
+type NotificationSetting struct {
+	UserID           uint       `gorm:"primaryKey;autoIncrement:false;column:userId" json:"userId"`
+	NewPostFrequency string     `gorm:"column:newPostFrequency;type:varchar(20);not null;default:immediate;index" json:"newPostFrequency"` // 订阅的作者/论坛有新帖时的通知频率
+	Locale           string     `gorm:"column:locale;type:varchar(10);not null;default:zh" json:"locale"`                                  // 邮件语言 (zh / en)
+	UnsubscribedAt   *time.Time `gorm:"column:unsubscribedAt" json:"unsubscribedAt"`                                                       // 不为空表示退订了所有通知邮件
+	UpdatedAt        time.Time  `gorm:"column:updatedAt" json:"updatedAt"`
+}
+
+func (NotificationSetting) TableName() string {
+	return "NotificationSetting"
+}
+
+func DefaultNotificationSetting(userID uint) NotificationSetting {
+	return NotificationSetting{
+		UserID:           userID,
+		NewPostFrequency: FrequencyImmediate,
+		Locale:           "zh",
+	}
+}
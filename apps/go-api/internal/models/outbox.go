@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Outbox 状态
+const (
+	OutboxStatusPending = "pending" // 等待投递 (包括投递失败等待重试的)
+	OutboxStatusSent    = "sent"    // 已投递到 MQ
+	OutboxStatusFailed  = "failed"  // 超过最大重试次数，需要人工介入 (修复后在管理后台重新排队)
+)
+
+// OutboxEvent 事务性发件箱
+// 业务数据和待发送的消息在同一个事务里写入，再由 worker 的 relay 异步投递到 MQ，保证至少一次送达
+// relay 领取时把 NextAttemptAt 推到租约到期时间，实例挂掉后租约过期，消息会被重新领取
+type OutboxEvent struct {
+	ID            uint       `gorm:"primaryKey;column:id" json:"id"`
+	Pattern       string     `gorm:"column:pattern;type:varchar(100);not null" json:"pattern"`
+	Payload       string     `gorm:"column:payload;type:text;not null" json:"payload"` // 消息的 data 部分 (JSON)
+	Status        string     `gorm:"column:status;type:varchar(20);not null;default:pending;index:idx_outbox_status_next,priority:1" json:"status"`
+	Attempts      int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"column:nextAttemptAt;not null;index:idx_outbox_status_next,priority:2" json:"nextAttemptAt"`
+	LastError     string     `gorm:"column:lastError;type:text" json:"lastError"`
+	LeaseID       string     `gorm:"column:leaseId;type:varchar(36);not null;default:''" json:"-"` // relay 领取时写入，投递完只有持有租约的实例能改状态
+	CreatedAt     time.Time  `gorm:"column:createdAt" json:"createdAt"`
+	SentAt        *time.Time `gorm:"column:sentAt" json:"sentAt"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "Outbox"
+}
@@ -2,20 +2,31 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Post 对应数据库中的 Post 表 (Prisma 创建的)
 type Post struct {
-	ID uint `gorm:"primaryKey;column:id" json:"id"`
+	ID uint `gorm:"primaryKey;column:id;index:idx_post_created_at_id,priority:2" json:"id"`
 	// 指定 column:title 虽非必须(如果也是小写)，但为了保险加上
 	Title     string `gorm:"column:title;type:varchar(255);not null" json:"title" binding:"required"`
 	Content   string `gorm:"column:content;type:text" json:"content"`
 	Published bool   `gorm:"column:published;default:false" json:"published"`
 
+	// 评论数 (冗余字段，随评论的增删一起维护，避免列表页每次 COUNT)
+	// 列也在 Prisma 的迁移里，类型和 Prisma 的 Int 保持一致
+	CommentCount int `gorm:"column:commentCount;type:integer;not null;default:0" json:"commentCount"`
+
 	// 🔥 关键点：Prisma 字段是驼峰 createdAt，GORM 默认找 created_at，必须手动指定
-	CreatedAt time.Time `gorm:"column:createdAt" json:"createdAt"`
+	// 与 ID 组成联合索引，支撑列表的键集分页
+	CreatedAt time.Time `gorm:"column:createdAt;index:idx_post_created_at_id,priority:1" json:"createdAt"`
 	UpdatedAt time.Time `gorm:"column:updatedAt" json:"updatedAt"`
 
+	// 软删除：GORM 查询时会自动过滤 deletedAt 不为空的记录，版主可以恢复
+	// 列和索引也在 Prisma 的迁移里 (apps/api/prisma)，索引名和 Prisma 保持一致，避免建两份
+	DeletedAt gorm.DeletedAt `gorm:"column:deletedAt;index:Post_deletedAt_idx" json:"-"`
+
 	// 如果有关联用户，Prisma 通常是 authorId
 	AuthorID uint `gorm:"column:authorId" json:"authorId"`
 }
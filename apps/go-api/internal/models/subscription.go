@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// 订阅目标类型
+const (
+	SubscriptionTargetForum  = "forum"  // 整个论坛的新帖
+	SubscriptionTargetAuthor = "author" // 某个作者的新帖
+)
+
+// Subscription 用户订阅 (关注作者或整个论坛)
+// 订阅整个论坛时 TargetID 为 0；唯一索引保证重复订阅是幂等的
+type Subscription struct {
+	ID         uint      `gorm:"primaryKey;column:id" json:"id"`
+	UserID     uint      `gorm:"column:userId;not null;uniqueIndex:idx_subscription_user_target,priority:1" json:"userId"`
+	TargetType string    `gorm:"column:targetType;type:varchar(20);not null;uniqueIndex:idx_subscription_user_target,priority:2;index:idx_subscription_target,priority:1" json:"targetType"`
+	TargetID   uint      `gorm:"column:targetId;not null;default:0;uniqueIndex:idx_subscription_user_target,priority:3;index:idx_subscription_target,priority:2" json:"targetId"`
+	CreatedAt  time.Time `gorm:"column:createdAt" json:"createdAt"`
+}
+
+func (Subscription) TableName() string {
+	return "Subscription"
+}
@@ -2,12 +2,32 @@ package models
 
 import "time"
 
+// 用户角色
+const (
+	RoleUser      = "user"      // 普通用户
+	RoleModerator = "moderator" // 版主：可以管理帖子
+	RoleAdmin     = "admin"     // 管理员：拥有全部权限，包括修改用户角色
+)
+
+// IsValidRole 校验角色名是否合法
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 // User 对应 Prisma 生成的 "User" 表
 type User struct {
 	ID       uint   `gorm:"primaryKey;column:id" json:"id"`
 	Email    string `gorm:"column:email;unique;not null" json:"email"`
 	Name     string `gorm:"column:name" json:"name"`
 	Password string `gorm:"column:password" json:"-"` // json:"-" 表示返回前端时不带密码
+	Role     string `gorm:"column:role;type:varchar(20);not null;default:user" json:"role"`
+
+	// 邮箱验证时间，为空表示还没验证
+	EmailVerifiedAt *time.Time `gorm:"column:emailVerifiedAt" json:"emailVerifiedAt"`
 
 	// Prisma 是驼峰 createdAt，必须映射
 	CreatedAt time.Time `gorm:"column:createdAt" json:"createdAt"`
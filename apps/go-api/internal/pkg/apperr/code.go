@@ -1,27 +1,65 @@
 package apperr
 
 const (
-	CodeSuccess         = 0
-	CodeInvalidParam    = 40001
-	CodeUnauthorized    = 40101
-	CodeUserNotFound    = 40401
-	CodeUserExist       = 40402
-	CodeArticleNotExist = 40403
-	CodeTitleNotExist   = 40404
-	CodeInternalError   = 50001
-	CodeStripeError     = 60001
+	CodeSuccess            = 0
+	CodeInvalidParam       = 40001
+	CodeFileEmpty          = 40002
+	CodeUploadNotFinished  = 40003
+	CodeUnauthorized       = 40101
+	CodeRefreshInvalid     = 40102
+	CodeRefreshReused      = 40103
+	CodeVerifyInvalid      = 40104
+	CodeResetInvalid       = 40105
+	CodeForbidden          = 40301
+	CodeEmailUnverified    = 40302
+	CodeQuotaExceeded      = 40303
+	CodeUserNotFound       = 40401
+	CodeUserExist          = 40402
+	CodeArticleNotExist    = 40403
+	CodeTitleNotExist      = 40404
+	CodeCommentNotExist    = 40405
+	CodeDeadLetterNotExist = 40406
+	CodeTemplateNotExist   = 40407
+	CodeAttachmentNotExist = 40408
+	CodeOutboxNotExist     = 40409
+	CodeFileTooLarge       = 41301
+	CodeFileTypeNotAllowed = 41501
+	CodeFileExtMismatch    = 41502
+	CodeFileNotAsDeclared  = 41503
+	CodeInternalError      = 50001
+	CodeServiceUnavailable = 50301
+	CodeStripeError        = 60001
 )
 
 var codeMsg = map[int]string{
-	CodeSuccess:         "成功",
-	CodeInvalidParam:    "参数错误",
-	CodeUnauthorized:    "未授权或Token失效",
-	CodeUserNotFound:    "用户不存在",
-	CodeUserExist:       "用户已存在",
-	CodeArticleNotExist: "文章不存在",
-	CodeTitleNotExist:   "标题是必填项",
-	CodeInternalError:   "服务器内部故障",
-	CodeStripeError:     "Stripe Error",
+	CodeSuccess:            "成功",
+	CodeInvalidParam:       "参数错误",
+	CodeFileEmpty:          "文件为空",
+	CodeUploadNotFinished:  "文件还没有上传完成",
+	CodeUnauthorized:       "未授权或Token失效",
+	CodeRefreshInvalid:     "刷新令牌无效或已过期",
+	CodeRefreshReused:      "刷新令牌被重复使用，会话已注销",
+	CodeVerifyInvalid:      "验证链接无效或已过期",
+	CodeResetInvalid:       "重置链接无效或已过期",
+	CodeForbidden:          "无权操作该资源",
+	CodeEmailUnverified:    "请先验证邮箱",
+	CodeQuotaExceeded:      "存储空间或文件数已达上限",
+	CodeUserNotFound:       "用户不存在",
+	CodeUserExist:          "用户已存在",
+	CodeArticleNotExist:    "文章不存在",
+	CodeTitleNotExist:      "标题是必填项",
+	CodeCommentNotExist:    "评论不存在",
+	CodeDeadLetterNotExist: "死信不存在",
+	CodeTemplateNotExist:   "邮件模板不存在",
+	CodeAttachmentNotExist: "附件不存在",
+	CodeOutboxNotExist:     "消息不存在或不是失败状态",
+	CodeFileTooLarge:       "文件超过大小限制",
+	CodeFileTypeNotAllowed: "不支持的文件类型",
+	CodeFileExtMismatch:    "文件扩展名与内容不符",
+	CodeFileNotAsDeclared:  "上传的文件与声明的类型或大小不符",
+	CodeInternalError:      "服务器内部故障",
+	CodeServiceUnavailable: "依赖服务不可用",
+	CodeStripeError:        "Stripe Error",
 }
 
 func GetMsg(code int) string {
@@ -0,0 +1,198 @@
+// Package blob 按内容寻址的存储对象和引用计数
+// 相同内容的上传共享同一个对象，附件只是引用；引用计数在数据库里维护，对象由清理任务在没有引用后删除
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"go-api/internal/models"
+	"go-api/internal/pkg/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrDeleting 对象正在被清理任务删除，稍后重试 (记录删掉之后再上传会按新对象写入)
+var ErrDeleting = errors.New("blob: object is being deleted")
+
+// StagingPrefix 暂存位置 (私有)，内容确认后复制到内容 key 再删除；没删掉的由清理任务过期删除
+const StagingPrefix = storage.PrivatePrefix + "incoming/"
+
+// Key 按内容寻址的 key：ab/abcdef...jpg
+// 用哈希的前两位分一级目录，避免本地磁盘单个目录下文件过多
+func Key(checksum, ext string) string {
+	return checksum[:2] + "/" + checksum + ext
+}
+
+// StagingKey 暂存 key，每次都不同：直传的上传位置、登记时校验用的副本、API 上传的文件
+// 还没有校验 (或者还没有登记) 的内容不能直接写到内容 key 上覆盖别人的文件
+func StagingKey(ext string) string {
+	return StagingPrefix + uuid.New().String() + ext
+}
+
+// Checksum 计算 r 的 SHA-256 (hex)
+func Checksum(r io.Reader) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// WriteKey 新内容写入的位置：图片先写到私有的原图 key，等 worker 去除元数据后再公开；其它文件直接写到内容 key
+func WriteKey(b *models.Blob) string {
+	if InitialStatus(b.MimeType) == models.BlobPending {
+		return b.OriginalKey()
+	}
+	return b.Key
+}
+
+// InitialStatus 新对象写入完成后的状态：图片要等 worker 处理完，其它文件写完就能用
+func InitialStatus(contentType string) string {
+	if strings.HasPrefix(contentType, "image/") {
+		return models.BlobPending
+	}
+	return models.BlobReady
+}
+
+// Acquire 给 b.Key 对应的对象加一个引用 (需要传入事务)，对象不存在时用 b 创建
+// 返回 true 表示新建了记录，调用方需要写入对象 (并按需处理图片)；否则 b 被替换成已有的记录
+// 引用减到 0 但还没被清理的对象直接复用：清理任务先把记录标记为 deleting 才开始删对象，没有标记的对象都还在
+// 已经标记为 deleting 的返回 ErrDeleting；更新引用会锁住这一行直到事务结束，清理任务在这之后也标记不了
+// 处理失败的对象 (原图已删除) 重置为 storing 并返回 true，由这次上传重新写入；并发的重复上传会等这一行的锁，之后按 storing 复用
+func Acquire(tx *gorm.DB, b *models.Blob) (bool, error) {
+	b.RefCount = 1
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(b)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+
+	res = tx.Model(b).Clauses(clause.Returning{}).
+		Where("status = ?", models.BlobFailed).
+		Updates(map[string]interface{}{
+			"refCount":     gorm.Expr(`"refCount" + 1`),
+			"status":       models.BlobStoring,
+			"size":         b.Size,
+			"mimeType":     b.MimeType,
+			"width":        0,
+			"height":       0,
+			"variants":     nil,
+			"processError": "",
+			"updatedAt":    time.Now(),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+
+	res = tx.Model(b).Clauses(clause.Returning{}).
+		Where("status <> ?", models.BlobDeleting).
+		Updates(map[string]interface{}{"refCount": gorm.Expr(`"refCount" + 1`), "updatedAt": time.Now()})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, ErrDeleting // 正在删除，或者刚刚被删掉
+	}
+	return false, nil
+}
+
+// Release 去掉一个引用 (需要传入事务)，对象留给清理任务删除
+func Release(tx *gorm.DB, key string) error {
+	return tx.Model(&models.Blob{}).
+		Where(`key = ? AND "refCount" > 0`, key).
+		Updates(map[string]interface{}{"refCount": gorm.Expr(`"refCount" - 1`), "updatedAt": time.Now()}).Error
+}
+
+// RemoveAttachments 删除附件并释放引用 (需要传入事务)，返回需要在提交后交给 PurgeStaging 的附件
+// 还没登记的直传没有引用 Blob，临时对象只属于它自己：这里只标记为 deleting，不在事务里访问存储
+// 按 key 排序后释放，多个事务同时释放一批引用时加锁顺序一致，不会死锁
+func RemoveAttachments(tx *gorm.DB, atts []models.Attachment) ([]models.Attachment, error) {
+	var ids, stagingIDs []uint
+	var keys []string
+	var staging []models.Attachment
+	for _, att := range atts {
+		if att.Status != models.AttachmentReady {
+			stagingIDs = append(stagingIDs, att.ID)
+			staging = append(staging, att)
+			continue
+		}
+		ids = append(ids, att.ID)
+		keys = append(keys, att.Key)
+	}
+
+	// 只改状态不刷新 updatedAt，清理任务按原来的时间继续处理
+	if len(stagingIDs) > 0 {
+		if err := tx.Model(&models.Attachment{}).Where("id IN ?", stagingIDs).
+			UpdateColumn("status", models.AttachmentDeleting).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(ids) > 0 {
+		if err := tx.Delete(&models.Attachment{}, ids).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := Release(tx, key); err != nil {
+			return nil, err
+		}
+	}
+	return staging, nil
+}
+
+// PurgeStaging 删除 RemoveAttachments 标记的直传临时对象，删掉对象之后再删记录 (不要在事务里调用)
+// 删除失败的保留 deleting 记录，清理任务下一轮再试；返回所有失败
+func PurgeStaging(ctx context.Context, db *gorm.DB, store storage.Backend, atts []models.Attachment) error {
+	var errs []error
+	for _, att := range atts {
+		if err := store.Delete(ctx, att.Key); err != nil {
+			errs = append(errs, fmt.Errorf("delete %s: %w", att.Key, err))
+			continue
+		}
+		if err := db.WithContext(ctx).Where("id = ? AND status = ?", att.ID, models.AttachmentDeleting).
+			Delete(&models.Attachment{}).Error; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Load 批量查询附件引用的 Blob，按 key 索引
+func Load(db *gorm.DB, atts []models.Attachment) (map[string]*models.Blob, error) {
+	keys := make([]string, 0, len(atts))
+	for _, att := range atts {
+		if att.Status == models.AttachmentReady {
+			keys = append(keys, att.Key)
+		}
+	}
+	blobs := make(map[string]*models.Blob, len(keys))
+	if len(keys) == 0 {
+		return blobs, nil
+	}
+
+	var rows []models.Blob
+	if err := db.Where("key IN ?", keys).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		blobs[rows[i].Key] = &rows[i]
+	}
+	return blobs, nil
+}
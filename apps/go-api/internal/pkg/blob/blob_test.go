@@ -0,0 +1,219 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go-api/internal/config"
+	"go-api/internal/models"
+	"go-api/internal/pkg/storage"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	// 每个连接都是一个独立的内存数据库，只用一个连接
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Blob{}, &models.Attachment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func newBlob(key string) *models.Blob {
+	return &models.Blob{Key: key, Checksum: key, Size: 10, MimeType: "image/png", Status: models.BlobStoring}
+}
+
+func refCount(t *testing.T, db *gorm.DB, key string) int {
+	t.Helper()
+	var b models.Blob
+	if err := db.Where("key = ?", key).First(&b).Error; err != nil {
+		t.Fatalf("load blob %s: %v", key, err)
+	}
+	return b.RefCount
+}
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  *models.Blob // 已有的记录，nil 表示第一次上传
+		wantFresh bool
+		wantErr   error
+		wantRefs  int
+		wantState string // Acquire 之后 b 的状态：新建时是传入的，复用时是已有记录的
+	}{
+		{"first upload", nil, true, nil, 1, models.BlobStoring},
+		{"deduplicated", &models.Blob{RefCount: 2, Status: models.BlobReady}, false, nil, 3, models.BlobReady},
+		{"deduplicated while storing", &models.Blob{RefCount: 1, Status: models.BlobStoring}, false, nil, 2, models.BlobStoring},
+		{"unreferenced but not swept", &models.Blob{RefCount: 0, Status: models.BlobReady}, false, nil, 1, models.BlobReady},
+		{"being swept", &models.Blob{RefCount: 0, Status: models.BlobDeleting}, false, ErrDeleting, 0, ""},
+		{"previously failed", &models.Blob{RefCount: 1, Status: models.BlobFailed}, true, nil, 2, models.BlobStoring},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if tt.existing != nil {
+				existing := newBlob("ab/abc.png")
+				existing.RefCount, existing.Status = tt.existing.RefCount, tt.existing.Status
+				existing.Variants = map[string]string{"thumb": "ab/abc_thumb.png"}
+				if err := db.Create(existing).Error; err != nil {
+					t.Fatalf("create existing: %v", err)
+				}
+			}
+
+			b := newBlob("ab/abc.png")
+			fresh, err := Acquire(db, b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Acquire err = %v, want %v", err, tt.wantErr)
+			}
+			if fresh != tt.wantFresh {
+				t.Errorf("fresh = %v, want %v", fresh, tt.wantFresh)
+			}
+			if got := refCount(t, db, b.Key); got != tt.wantRefs {
+				t.Errorf("refCount = %d, want %d", got, tt.wantRefs)
+			}
+			if err != nil {
+				return
+			}
+			if b.Status != tt.wantState || b.RefCount != tt.wantRefs {
+				t.Errorf("b = {status %s, refCount %d}, want {%s, %d}", b.Status, b.RefCount, tt.wantState, tt.wantRefs)
+			}
+			switch {
+			case tt.existing != nil && !tt.wantFresh && b.Variants["thumb"] == "":
+				t.Error("deduplicated blob lost the existing variants")
+			case tt.existing != nil && tt.wantFresh && len(b.Variants) > 0:
+				t.Errorf("reset blob kept stale variants %v", b.Variants)
+			}
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	db := newTestDB(t)
+	b := newBlob("ab/abc.png")
+	b.RefCount = 2
+	db.Create(b)
+
+	for i, want := range []int{1, 0, 0} { // 不会减成负数
+		if err := Release(db, b.Key); err != nil {
+			t.Fatalf("Release #%d: %v", i, err)
+		}
+		if got := refCount(t, db, b.Key); got != want {
+			t.Fatalf("after Release #%d refCount = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestRemoveAttachments(t *testing.T) {
+	db := newTestDB(t)
+	for _, key := range []string{"ab/a.png", "cd/c.png"} {
+		b := newBlob(key)
+		b.RefCount = 2
+		db.Create(b)
+	}
+	atts := []models.Attachment{
+		{OwnerID: 1, Key: "cd/c.png", Size: 10, MimeType: "image/png", Status: models.AttachmentReady},
+		{OwnerID: 1, Key: "ab/a.png", Size: 10, MimeType: "image/png", Status: models.AttachmentReady},
+		{OwnerID: 1, Key: StagingKey(".png"), Size: 10, MimeType: "image/png", Status: models.AttachmentUploading},
+	}
+	db.Create(&atts)
+
+	staging, err := RemoveAttachments(db, atts)
+	if err != nil {
+		t.Fatalf("RemoveAttachments: %v", err)
+	}
+	if len(staging) != 1 || staging[0].ID != atts[2].ID {
+		t.Fatalf("staging = %+v, want only the uploading attachment", staging)
+	}
+	for _, key := range []string{"ab/a.png", "cd/c.png"} {
+		if got := refCount(t, db, key); got != 1 {
+			t.Errorf("refCount(%s) = %d, want 1", key, got)
+		}
+	}
+
+	// 登记过的附件直接删掉；直传的附件留给 PurgeStaging，先删对象再删记录
+	var left []models.Attachment
+	db.Find(&left)
+	if len(left) != 1 || left[0].Status != models.AttachmentDeleting {
+		t.Fatalf("remaining attachments = %+v, want one deleting", left)
+	}
+}
+
+// failingStore 删除总是失败的存储
+type failingStore struct{ storage.Backend }
+
+func (failingStore) Delete(ctx context.Context, key string) error {
+	return errors.New("storage down")
+}
+
+func TestPurgeStaging(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalBackend(config.StorageConfig{LocalDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		store       storage.Backend
+		wantErr     bool
+		wantRows    int64
+		wantObjects bool
+	}{
+		{"deleted", store, false, 0, false},
+		{"storage failure keeps the row for the next sweep", failingStore{store}, true, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			att := models.Attachment{OwnerID: 1, Key: StagingKey(".png"), Size: 1, MimeType: "image/png", Status: models.AttachmentDeleting}
+			db.Create(&att)
+			if err := store.Put(ctx, att.Key, strings.NewReader("x"), 1, att.MimeType); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			if err := PurgeStaging(ctx, db, tt.store, []models.Attachment{att}); (err != nil) != tt.wantErr {
+				t.Fatalf("PurgeStaging err = %v, want error %v", err, tt.wantErr)
+			}
+			var rows int64
+			db.Model(&models.Attachment{}).Count(&rows)
+			if rows != tt.wantRows {
+				t.Errorf("rows = %d, want %d", rows, tt.wantRows)
+			}
+			_, err := store.Stat(ctx, att.Key)
+			if exists := err == nil; exists != tt.wantObjects {
+				t.Errorf("object exists = %v, want %v", exists, tt.wantObjects)
+			}
+		})
+	}
+}
+
+func TestWriteKey(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		{"image/png", "private/originals/ab/abc.png"},
+		{"application/pdf", "ab/abc.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			b := &models.Blob{Key: "ab/abc.png", MimeType: tt.mimeType, Status: models.BlobStoring}
+			if got := WriteKey(b); got != tt.want {
+				t.Errorf("WriteKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
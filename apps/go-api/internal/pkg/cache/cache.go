@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// 负缓存占位符：数据库里确实没有这条数据
+	nilPlaceholder = "__nil__"
+
+	// 负缓存的过期时间，短一点，避免数据刚创建就一直查不到
+	negativeTTL = 30 * time.Second
+
+	// 延迟双删的间隔：覆盖"删缓存时正好有请求在回源"的窗口
+	doubleDeleteDelay = 500 * time.Millisecond
+)
+
+// ErrNotFound 由 LoadFunc 返回，表示数据不存在 (会被负缓存)
+var ErrNotFound = errors.New("cache: not found")
+
+// LoadFunc 缓存未命中时的回源函数
+type LoadFunc func(ctx context.Context) (interface{}, error)
+
+// Cache 基于 Redis 的 Cache-Aside 封装
+// - singleflight：同一个 Key 并发未命中时只回源一次，防止缓存击穿
+// - 负缓存：不存在的数据也缓存一小段时间，防止缓存穿透
+// - TTL 随机抖动：避免大量 Key 同时过期造成雪崩
+type Cache struct {
+	rdb   *redis.Client
+	group singleflight.Group
+}
+
+func New(rdb *redis.Client) *Cache {
+	return &Cache{rdb: rdb}
+}
+
+// Fetch 先读缓存，未命中则调用 load 回源并回写，结果反序列化到 dest
+func (c *Cache) Fetch(ctx context.Context, key string, ttl time.Duration, dest interface{}, load LoadFunc) error {
+	return c.fetch(ctx, "", key, ttl, dest, load)
+}
+
+// FetchIndexed 与 Fetch 相同，但会把 key 登记到 index (Set) 中
+// 适合分页、筛选这类 Key 不固定的场景，之后用 InvalidateIndex 一次性失效
+func (c *Cache) FetchIndexed(ctx context.Context, index, key string, ttl time.Duration, dest interface{}, load LoadFunc) error {
+	return c.fetch(ctx, index, key, ttl, dest, load)
+}
+
+func (c *Cache) fetch(ctx context.Context, index, key string, ttl time.Duration, dest interface{}, load LoadFunc) error {
+	// 1. 读缓存 (Redis 故障时不报错，直接降级回源)
+	cached, err := c.rdb.Get(ctx, key).Result()
+	if err == nil {
+		if cached == nilPlaceholder {
+			return ErrNotFound
+		}
+		if json.Unmarshal([]byte(cached), dest) == nil {
+			return nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		slog.Error("cache_get_failed", "key", key, "err", err)
+	}
+
+	// 2. 未命中：同一个 Key 只放一个请求去回源，其他请求等结果
+	// 回源不跟随单个请求的取消，否则一个请求断开会连累所有等待者
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		loadCtx := context.WithoutCancel(ctx)
+
+		data, err := load(loadCtx)
+		if errors.Is(err, ErrNotFound) {
+			c.set(loadCtx, index, key, nilPlaceholder, negativeTTL)
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		c.set(loadCtx, index, key, string(raw), jitter(ttl))
+		return raw, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(v.([]byte), dest)
+}
+
+// set 回写缓存，失败只记录日志
+func (c *Cache) set(ctx context.Context, index, key, value string, ttl time.Duration) {
+	pipe := c.rdb.TxPipeline()
+	pipe.Set(ctx, key, value, ttl)
+	if index != "" {
+		pipe.SAdd(ctx, index, key)
+		// 索引比数据活得久一点，保证失效时能找到所有 Key
+		pipe.Expire(ctx, index, 2*ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("cache_set_failed", "key", key, "err", err)
+	}
+}
+
+// Invalidate 删除指定 Key，并在短暂延迟后再删一次 (延迟双删)
+// 防止删除时恰好有请求读到旧数据并回写
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	if err := c.rdb.Del(ctx, keys...).Err(); err != nil {
+		slog.Error("cache_invalidate_failed", "keys", keys, "err", err)
+	}
+	time.AfterFunc(doubleDeleteDelay, func() {
+		c.rdb.Del(context.Background(), keys...)
+	})
+}
+
+// InvalidateIndex 删除 index 中登记的所有 Key 以及 index 本身 (同样延迟双删)
+func (c *Cache) InvalidateIndex(ctx context.Context, index string) {
+	c.invalidateIndex(ctx, index)
+	time.AfterFunc(doubleDeleteDelay, func() {
+		c.invalidateIndex(context.Background(), index)
+	})
+}
+
+func (c *Cache) invalidateIndex(ctx context.Context, index string) {
+	keys, err := c.rdb.SMembers(ctx, index).Result()
+	if err != nil {
+		slog.Error("cache_invalidate_failed", "index", index, "err", err)
+		return
+	}
+	keys = append(keys, index)
+	if err := c.rdb.Del(ctx, keys...).Err(); err != nil {
+		slog.Error("cache_invalidate_failed", "index", index, "err", err)
+	}
+}
+
+// jitter 在 TTL 基础上随机增加 0~10%
+func jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int64N(int64(ttl)/10+1))
+}
@@ -0,0 +1,146 @@
+// Package imaging 只用标准库完成图片的解码、缩放和重新编码
+// 重新编码不会写入任何元数据 (EXIF/GPS、PNG 文本块、GIF 注释)，这就是去除元数据的方式
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+)
+
+var (
+	// ErrUnsupported 标准库没有对应的解码器 (如 webp)
+	ErrUnsupported = errors.New("imaging: unsupported format")
+	// ErrTooManyPixels 宽x高超过上限，可能是解压炸弹
+	ErrTooManyPixels = errors.New("imaging: image too large")
+)
+
+// Image 解码后的图片，已经按 EXIF 方向转正
+type Image struct {
+	RGBA   *image.RGBA
+	Format string
+}
+
+func (img *Image) Width() int  { return img.RGBA.Rect.Dx() }
+func (img *Image) Height() int { return img.RGBA.Rect.Dy() }
+
+// Decode 先只读文件头检查尺寸，再完整解码
+// JPEG 会读取 EXIF 里的方向并转正，因为重新编码后方向信息就没了
+func Decode(data []byte, maxPixels int) (*Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data)) // GIF 只取第一帧
+	if err != nil {
+		return nil, err
+	}
+	rgba := toRGBA(src)
+	if format == FormatJPEG {
+		rgba = orient(rgba, jpegOrientation(data))
+	}
+	return &Image{RGBA: rgba, Format: format}, nil
+}
+
+// Encode 按原图格式重新编码，GIF 的缩略图编码成 PNG (静态的第一帧)
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	if format == FormatJPEG {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	return png.Encode(w, img)
+}
+
+// VariantFormat 缩略图的输出格式
+func VariantFormat(format string) string {
+	if format == FormatJPEG {
+		return FormatJPEG
+	}
+	return FormatPNG
+}
+
+// StripGIF 动图整体重新编码 (保留所有帧和循环次数)，去掉注释和应用扩展块
+func StripGIF(data []byte) ([]byte, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Resize 按比例缩小到长边不超过 maxEdge，使用区域平均 (box filter)
+// 原图已经不超过 maxEdge 时返回 nil，不做放大
+func Resize(src *image.RGBA, maxEdge int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw <= maxEdge && sh <= maxEdge {
+		return nil
+	}
+
+	dw, dh := maxEdge, maxEdge
+	if sw >= sh {
+		dh = max(1, sh*maxEdge/sw)
+	} else {
+		dw = max(1, sw*maxEdge/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		sy0 := dy * sh / dh
+		sy1 := max(sy0+1, (dy+1)*sh/dh)
+		for dx := 0; dx < dw; dx++ {
+			sx0 := dx * sw / dw
+			sx1 := max(sx0+1, (dx+1)*sw/dw)
+
+			// RGBA 是预乘 alpha 的，直接对四个通道求平均即可
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				row := src.Pix[sy*src.Stride+sx0*4 : sy*src.Stride+sx1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+					a += uint64(row[i+3])
+					n++
+				}
+			}
+			o := dy*dst.Stride + dx*4
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(b / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// toRGBA 统一转换成原点在 (0,0) 的 RGBA，方便直接操作像素
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, src, b.Min, draw.Src)
+	return dst
+}
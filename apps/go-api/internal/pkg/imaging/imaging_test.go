@@ -0,0 +1,323 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// secret 测试用的"隐私数据"，重新编码之后不能出现在输出里
+const secret = "GPS 31.2304N 121.4737E"
+
+// exifSegment 构造一个 APP1 (Exif) 段：IFD0 里只有方向标签，后面跟着 secret
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8)) // IFD0 的偏移
+	binary.Write(&tiff, order, uint16(1)) // 1 个条目
+	binary.Write(&tiff, order, uint16(tagOrientation))
+	binary.Write(&tiff, order, uint16(3)) // SHORT
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, orientation)
+	binary.Write(&tiff, order, uint16(0)) // 值占 4 字节，补齐
+	binary.Write(&tiff, order, uint32(0)) // 没有下一个 IFD
+	tiff.WriteString(secret)
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// withExif 把 APP1 段插到 SOI 后面
+func withExif(jpg, app1 []byte) []byte {
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, app1...)
+	return append(out, jpg[2:]...)
+}
+
+// halves 左半边红、右半边蓝的图片
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func isRed(c color.RGBA) bool  { return c.R > 200 && c.B < 60 }
+func isBlue(c color.RGBA) bool { return c.B > 200 && c.R < 60 }
+
+func TestJPEGOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, halves(16, 8))
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", jpg, 1},
+		{"little endian", withExif(jpg, exifSegment(binary.LittleEndian, 6)), 6},
+		{"big endian", withExif(jpg, exifSegment(binary.BigEndian, 8)), 8},
+		{"out of range value", withExif(jpg, exifSegment(binary.LittleEndian, 9)), 1},
+		{"truncated segment", withExif(jpg, exifSegment(binary.LittleEndian, 6))[:20], 1},
+		{"not a jpeg", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 3x2 的原图，每个像素用 R 通道标记：
+	//   a b c
+	//   d e f
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i, id := range "abcdef" {
+		src.Pix[i*4] = uint8(id)
+	}
+
+	tests := []struct {
+		orientation int
+		want        []string // 转正后的每一行
+	}{
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(rune('0'+tt.orientation)), func(t *testing.T) {
+			dst := orient(src, tt.orientation)
+			if dst.Rect.Dy() != len(tt.want) || dst.Rect.Dx() != len(tt.want[0]) {
+				t.Fatalf("size = %dx%d, want %dx%d", dst.Rect.Dx(), dst.Rect.Dy(), len(tt.want[0]), len(tt.want))
+			}
+			for y, row := range tt.want {
+				for x, id := range row {
+					if got := dst.Pix[y*dst.Stride+x*4]; got != uint8(id) {
+						t.Errorf("pixel (%d,%d) = %c, want %c", x, y, got, id)
+					}
+				}
+			}
+		})
+	}
+}
+
+// EXIF 方向 6 (顺时针 90°)：解码后宽高互换，原来的左半边 (红) 转到上面
+func TestDecodeAppliesOrientation(t *testing.T) {
+	data := withExif(encodeJPEG(t, halves(16, 8)), exifSegment(binary.BigEndian, 6))
+
+	img, err := Decode(data, 0)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if img.Width() != 8 || img.Height() != 16 {
+		t.Fatalf("size = %dx%d, want 8x16", img.Width(), img.Height())
+	}
+	if top := img.RGBA.RGBAAt(4, 2); !isRed(top) {
+		t.Errorf("top pixel = %v, want red", top)
+	}
+	if bottom := img.RGBA.RGBAAt(4, 13); !isBlue(bottom) {
+		t.Errorf("bottom pixel = %v, want blue", bottom)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		maxPixels int
+		wantErr   error
+	}{
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00"), 0, ErrUnsupported},
+		{"text", []byte("hello"), 0, ErrUnsupported},
+		{"too many pixels", encodeJPEG(t, halves(16, 8)), 100, ErrTooManyPixels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data, tt.maxPixels); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// pngWithText 在 IHDR 后面插一个 tEXt 块
+func pngWithText(t *testing.T, text string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, halves(4, 4)); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	data := buf.Bytes()
+
+	body := append([]byte("tEXt"), []byte("Comment\x00"+text)...)
+	chunk := make([]byte, 4, 4+len(body)+4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4 // 签名 + IHDR (长度、类型、数据、CRC)
+	out := append([]byte{}, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+// gifWithComment 两帧的动图，结尾前插一个注释扩展块
+func gifWithComment(t *testing.T, comment string) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{LoopCount: 3}
+	for i := 0; i < 2; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("gif.EncodeAll: %v", err)
+	}
+	data := buf.Bytes()
+
+	ext := []byte{0x21, 0xFE, byte(len(comment))}
+	ext = append(ext, comment...)
+	ext = append(ext, 0x00)
+	out := append([]byte{}, data[:len(data)-1]...) // 去掉结尾的 0x3B
+	out = append(out, ext...)
+	return append(out, 0x3B)
+}
+
+// 重新编码之后不能再带着 EXIF / 文本块 / 注释
+func TestStripMetadata(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		strip func(data []byte) ([]byte, error)
+	}{
+		{
+			name: "jpeg exif",
+			data: withExif(encodeJPEG(t, halves(16, 8)), exifSegment(binary.LittleEndian, 3)),
+			strip: func(data []byte) ([]byte, error) {
+				img, err := Decode(data, 0)
+				if err != nil {
+					return nil, err
+				}
+				var buf bytes.Buffer
+				err = Encode(&buf, img.RGBA, img.Format, 85)
+				return buf.Bytes(), err
+			},
+		},
+		{
+			name: "png text chunk",
+			data: pngWithText(t, secret),
+			strip: func(data []byte) ([]byte, error) {
+				img, err := Decode(data, 0)
+				if err != nil {
+					return nil, err
+				}
+				var buf bytes.Buffer
+				err = Encode(&buf, img.RGBA, img.Format, 85)
+				return buf.Bytes(), err
+			},
+		},
+		{
+			name:  "gif comment",
+			data:  gifWithComment(t, secret),
+			strip: StripGIF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !bytes.Contains(tt.data, []byte(secret)) {
+				t.Fatal("test input does not contain the metadata")
+			}
+			out, err := tt.strip(tt.data)
+			if err != nil {
+				t.Fatalf("strip: %v", err)
+			}
+			if bytes.Contains(out, []byte(secret)) || bytes.Contains(out, []byte("Exif\x00")) {
+				t.Fatal("metadata survived re-encoding")
+			}
+			if _, _, err := image.DecodeConfig(bytes.NewReader(out)); err != nil {
+				t.Fatalf("output is not a valid image: %v", err)
+			}
+		})
+	}
+}
+
+func TestStripGIFKeepsAnimation(t *testing.T) {
+	out, err := StripGIF(gifWithComment(t, secret))
+	if err != nil {
+		t.Fatalf("StripGIF: %v", err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("gif.DecodeAll: %v", err)
+	}
+	if len(g.Image) != 2 || g.LoopCount != 3 {
+		t.Fatalf("frames = %d, loop = %d; want 2, 3", len(g.Image), g.LoopCount)
+	}
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name          string
+		w, h, maxEdge int
+		wantW, wantH  int
+		wantNil       bool
+	}{
+		{"landscape", 400, 200, 100, 100, 50, false},
+		{"portrait", 200, 400, 100, 50, 100, false},
+		{"already small", 80, 60, 100, 0, 0, true},
+		{"thin strip keeps one pixel", 1000, 2, 100, 100, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := Resize(halves(tt.w, tt.h), tt.maxEdge)
+			if tt.wantNil {
+				if dst != nil {
+					t.Fatalf("Resize = %v, want nil (no upscaling)", dst.Rect)
+				}
+				return
+			}
+			if dst.Rect.Dx() != tt.wantW || dst.Rect.Dy() != tt.wantH {
+				t.Fatalf("size = %dx%d, want %dx%d", dst.Rect.Dx(), dst.Rect.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
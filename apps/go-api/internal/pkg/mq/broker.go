@@ -0,0 +1,111 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-api/internal/config"
+)
+
+// 支持的 Broker 实现
+const (
+	DriverRabbitMQ = "rabbitmq" // 生产环境：RabbitMQ (AMQP)
+	DriverMemory   = "memory"   // 本地开发/测试：进程内 channel，不需要启动 MQ
+)
+
+// Message 与 NestJS Microservice 兼容的消息格式：{"pattern": "...", "data": {...}}
+type Message struct {
+	Pattern string      `json:"pattern"`
+	Data    interface{} `json:"data"`
+}
+
+// Handler 消费消息，msg 是完整的消息体 (JSON)
+// 返回 nil 表示处理成功 (ack)；返回 error 会按退避策略重试，重试耗尽后进入死信
+// 返回 Permanent(err) 表示重试也没用 (比如消息格式错误)，直接进入死信
+// 返回 ErrBusy 表示暂时处理不过来，延迟一个最短的重试间隔后重新投递，不计入重试次数
+type Handler func(msg []byte) error
+
+// ErrBusy 处理函数的并发槽位已满，消息稍后重新投递
+var ErrBusy = errors.New("mq: handler busy")
+
+// DeadLetter 重试耗尽或无法处理的消息
+type DeadLetter struct {
+	Body     []byte
+	Error    string
+	Attempts int // 已重试的次数
+}
+
+// DeadLetterHandler 接收死信 (通常是落库，供管理后台查看和重放)
+type DeadLetterHandler func(dl DeadLetter) error
+
+// Publisher 发送消息
+type Publisher interface {
+	Publish(ctx context.Context, pattern string, data interface{}) error
+}
+
+// Consumer 消费消息
+type Consumer interface {
+	StartConsumer(handler Handler)
+	StartDeadLetterConsumer(handler DeadLetterHandler)
+}
+
+// Broker 同时具备收发能力
+type Broker interface {
+	Publisher
+	Consumer
+	// Replay 把死信的原始消息体重新投递到主队列 (重试计数清零)
+	Replay(ctx context.Context, body []byte) error
+	// Connected 连接是否可用 (健康检查用)
+	Connected() bool
+	Close() error
+}
+
+// New 按配置创建 Broker
+func New(cfg config.RabbitMQConfig) (Broker, error) {
+	switch cfg.Driver {
+	case DriverMemory:
+		return NewMemoryBroker(cfg), nil
+	case DriverRabbitMQ, "":
+		r, err := NewRabbitMQ(cfg)
+		if err != nil {
+			return nil, err // 不能直接返回 r，否则会得到一个非 nil 的接口值
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("mq: unknown driver %q", cfg.Driver)
+	}
+}
+
+// encode 统一的消息编码，保证不同实现投递出去的格式完全一致
+func encode(pattern string, data interface{}) ([]byte, error) {
+	return json.Marshal(Message{Pattern: pattern, Data: data})
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记为不可重试的错误
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent 判断是否为不可重试的错误
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// retryDelay 第 attempt 次重试的延迟：base * 2^(attempt-1)
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	return base << (attempt - 1)
+}
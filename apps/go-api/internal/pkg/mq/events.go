@@ -0,0 +1,100 @@
+package mq
+
+import (
+	"context"
+	"time"
+)
+
+// 消息类型 (pattern)，与 NestJS 端的 @EventPattern 保持一致
+const (
+	PatternPostCreated            = "post_created"
+	PatternPostNotificationBatch  = "post_notification_batch" // post_created 扇出后的一批收件人
+	PatternPostCommented          = "post_commented"
+	PatternUserRegistered         = "user_registered"
+	PatternPasswordResetRequested = "password_reset_requested"
+	PatternSubscriptionChanged    = "subscription_changed"
+	PatternImageUploaded          = "image_uploaded" // 图片上传后异步生成缩略图、去除元数据
+)
+
+// NestPatterns NestJS 端 (apps/api 的 @EventPattern) 也要处理的 pattern，会同时投递到它监听的队列
+// 其它 pattern 只有 Go worker 处理，投递到 NestJS 的队列会被它丢掉
+var NestPatterns = []string{PatternPostCreated}
+
+// Recipient 通知收件人
+type Recipient struct {
+	UserID uint   `json:"userId"`
+	Email  string `json:"email"`
+	Locale string `json:"locale"` // 邮件语言，为空时用默认语言
+}
+
+// PublishNewPost 新帖发布
+func PublishNewPost(ctx context.Context, p Publisher, postID, authorID uint, title string) error {
+	return p.Publish(ctx, PatternPostCreated, map[string]interface{}{
+		"postId":   postID,
+		"authorId": authorID,
+		"title":    title,
+		"time":     time.Now(),
+	})
+}
+
+// PublishPostNotificationBatch 新帖通知的一批收件人，每批单独重试 (batch 是批次号，从 0 开始)
+func PublishPostNotificationBatch(ctx context.Context, p Publisher, postID uint, batch int, title string, recipients []Recipient) error {
+	return p.Publish(ctx, PatternPostNotificationBatch, map[string]interface{}{
+		"postId":     postID,
+		"batch":      batch,
+		"title":      title,
+		"recipients": recipients,
+		"time":       time.Now(),
+	})
+}
+
+// PublishPostCommented 帖子收到新评论，通知帖子作者
+func PublishPostCommented(ctx context.Context, p Publisher, postID, commentID uint, title string, authorID uint, authorEmail string) error {
+	return p.Publish(ctx, PatternPostCommented, map[string]interface{}{
+		"postId":      postID,
+		"commentId":   commentID,
+		"title":       title,
+		"authorId":    authorID,
+		"authorEmail": authorEmail,
+		"time":        time.Now(),
+	})
+}
+
+// PublishUserRegistered 新用户注册，发送邮箱验证邮件
+func PublishUserRegistered(ctx context.Context, p Publisher, userID uint, email, verifyURL string) error {
+	return p.Publish(ctx, PatternUserRegistered, map[string]interface{}{
+		"userId":    userID,
+		"email":     email,
+		"verifyUrl": verifyURL,
+		"time":      time.Now(),
+	})
+}
+
+// PublishPasswordReset 用户申请重置密码，发送重置链接
+func PublishPasswordReset(ctx context.Context, p Publisher, userID uint, email, resetURL string) error {
+	return p.Publish(ctx, PatternPasswordResetRequested, map[string]interface{}{
+		"userId":   userID,
+		"email":    email,
+		"resetUrl": resetURL,
+		"time":     time.Now(),
+	})
+}
+
+// PublishSubscriptionChanged Pro 订阅开通/续费/取消
+func PublishSubscriptionChanged(ctx context.Context, p Publisher, userID uint, email string, isPro bool, periodEnd *time.Time) error {
+	return p.Publish(ctx, PatternSubscriptionChanged, map[string]interface{}{
+		"userId":    userID,
+		"email":     email,
+		"isPro":     isPro,
+		"periodEnd": periodEnd,
+		"time":      time.Now(),
+	})
+}
+
+// PublishImageUploaded 图片上传完成，等待处理 (key 是按内容寻址的对象，同样的内容只处理一次)
+func PublishImageUploaded(ctx context.Context, p Publisher, key string) error {
+	return p.Publish(ctx, PatternImageUploaded, map[string]interface{}{
+		"key":  key,
+		"time": time.Now(),
+	})
+}
@@ -0,0 +1,182 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-api/internal/config"
+)
+
+// ErrBrokerClosed Broker 已关闭
+var ErrBrokerClosed = errors.New("mq: broker closed")
+
+type memoryDelivery struct {
+	body     []byte
+	attempts int
+}
+
+// MemoryBroker 进程内的消息队列 (带缓冲的 channel)
+// 重试通过定时器重新入队实现；消息不持久化，进程退出即丢失，只用于本地开发和测试
+type MemoryBroker struct {
+	queue       chan memoryDelivery
+	maxRetries  int
+	retryBase   time.Duration
+	concurrency int
+
+	mu         sync.RWMutex
+	closed     bool
+	done       chan struct{} // Close 时关闭；queue 本身从不关闭，阻塞中的 Publish 不会往已关闭的 channel 里写
+	deadLetter DeadLetterHandler
+}
+
+func NewMemoryBroker(cfg config.RabbitMQConfig) *MemoryBroker {
+	buffer := cfg.MemoryBuffer
+	if buffer <= 0 {
+		buffer = 1024
+	}
+	concurrency := cfg.Prefetch
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &MemoryBroker{
+		queue:       make(chan memoryDelivery, buffer),
+		maxRetries:  cfg.MaxRetries,
+		retryBase:   cfg.RetryBaseDelay,
+		concurrency: concurrency,
+		done:        make(chan struct{}),
+	}
+}
+
+// Publish 投递消息；队列满时阻塞，直到 ctx 超时
+func (m *MemoryBroker) Publish(ctx context.Context, pattern string, data interface{}) error {
+	body, err := encode(pattern, data)
+	if err != nil {
+		return err
+	}
+	if err := m.enqueue(ctx, memoryDelivery{body: body}); err != nil {
+		return err
+	}
+	slog.Info("✅ MemoryBroker Sent:", "pattern", pattern)
+	return nil
+}
+
+func (m *MemoryBroker) Replay(ctx context.Context, body []byte) error {
+	return m.enqueue(ctx, memoryDelivery{body: body})
+}
+
+// enqueue 阻塞等待期间不持有锁，否则队列满时 Close 拿不到写锁会死锁
+func (m *MemoryBroker) enqueue(ctx context.Context, d memoryDelivery) error {
+	select {
+	case <-m.done:
+		return ErrBrokerClosed
+	default:
+	}
+
+	select {
+	case m.queue <- d:
+		return nil
+	case <-m.done:
+		return ErrBrokerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartConsumer 后台消费，Close 之后会把缓冲区里剩余的消息处理完再退出
+func (m *MemoryBroker) StartConsumer(handler Handler) {
+	go func() {
+		slog.Info("🎧 MemoryBroker Consumer Started... Waiting for messages.")
+		// 和 RabbitMQ 的 prefetch 一样，最多同时处理 concurrency 条
+		slots := make(chan struct{}, m.concurrency)
+		dispatch := func(d memoryDelivery) {
+			slots <- struct{}{}
+			go func() {
+				defer func() { <-slots }()
+				m.handle(d, handler)
+			}()
+		}
+
+		for {
+			select {
+			case d := <-m.queue:
+				dispatch(d)
+			case <-m.done:
+				// 把缓冲区里剩下的处理完再退出
+				for {
+					select {
+					case d := <-m.queue:
+						dispatch(d)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// StartDeadLetterConsumer 内存实现没有死信队列，直接把死信交给 handler
+func (m *MemoryBroker) StartDeadLetterConsumer(handler DeadLetterHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deadLetter = handler
+}
+
+func (m *MemoryBroker) handle(d memoryDelivery, handler Handler) {
+	err := handler(d.body)
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, ErrBusy) {
+		time.AfterFunc(m.retryBase, func() {
+			if err := m.enqueue(context.Background(), d); err != nil {
+				slog.Error("❌ MemoryBroker Requeue Busy Failed:", "err", err)
+			}
+		})
+		return
+	}
+
+	if !IsPermanent(err) && d.attempts < m.maxRetries {
+		d.attempts++
+		delay := retryDelay(m.retryBase, d.attempts)
+		slog.Info("🔁 MemoryBroker Retry:", "attempt", d.attempts, "delay", delay, "err", err)
+		time.AfterFunc(delay, func() {
+			if err := m.enqueue(context.Background(), d); err != nil {
+				slog.Error("❌ MemoryBroker Retry Failed:", "err", err)
+			}
+		})
+		return
+	}
+
+	m.mu.RLock()
+	dlHandler := m.deadLetter
+	m.mu.RUnlock()
+
+	slog.Error("☠️ MemoryBroker Dead Letter:", "attempts", d.attempts, "err", err)
+	if dlHandler != nil {
+		if err := dlHandler(DeadLetter{Body: d.body, Error: err.Error(), Attempts: d.attempts}); err != nil {
+			slog.Error("❌ MemoryBroker Dead Letter Handler Failed:", "err", err)
+		}
+	}
+}
+
+// Connected 进程内队列没有连接，未关闭即可用
+func (m *MemoryBroker) Connected() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return !m.closed
+}
+
+func (m *MemoryBroker) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+	return nil
+}
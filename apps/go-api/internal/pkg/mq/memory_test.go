@@ -0,0 +1,104 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-api/internal/config"
+)
+
+// 队列满时 Publish 阻塞，Close 不能被它卡住，阻塞中的 Publish 要返回 ErrBrokerClosed
+func TestMemoryBrokerCloseWhilePublishBlocked(t *testing.T) {
+	m := NewMemoryBroker(config.RabbitMQConfig{MemoryBuffer: 1})
+	if err := m.Publish(context.Background(), "p", nil); err != nil {
+		t.Fatalf("first Publish: %v", err)
+	}
+
+	published := make(chan error, 1)
+	go func() { published <- m.Publish(context.Background(), "p", nil) }()
+	time.Sleep(20 * time.Millisecond) // 让第二个 Publish 阻塞在满队列上
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close deadlocked while Publish was blocked")
+	}
+	select {
+	case err := <-published:
+		if !errors.Is(err, ErrBrokerClosed) {
+			t.Fatalf("blocked Publish = %v, want ErrBrokerClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked Publish did not return after Close")
+	}
+
+	if err := m.Publish(context.Background(), "p", nil); !errors.Is(err, ErrBrokerClosed) {
+		t.Fatalf("Publish after Close = %v, want ErrBrokerClosed", err)
+	}
+}
+
+// Close 之后缓冲区里剩下的消息仍然会被处理
+func TestMemoryBrokerDrainsOnClose(t *testing.T) {
+	m := NewMemoryBroker(config.RabbitMQConfig{MemoryBuffer: 8})
+	for i := 0; i < 3; i++ {
+		if err := m.Publish(context.Background(), "p", i); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	m.Close()
+
+	handled := make(chan struct{}, 3)
+	m.StartConsumer(func(body []byte) error {
+		handled <- struct{}{}
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of 3 buffered messages handled after Close", i)
+		}
+	}
+}
+
+// 返回 ErrBusy 的消息稍后重新投递，不计入重试次数，也不会进死信
+func TestMemoryBrokerRequeuesBusy(t *testing.T) {
+	m := NewMemoryBroker(config.RabbitMQConfig{MaxRetries: 1, RetryBaseDelay: time.Millisecond})
+	defer m.Close()
+
+	deadLetters := make(chan DeadLetter, 1)
+	m.StartDeadLetterConsumer(func(dl DeadLetter) error {
+		deadLetters <- dl
+		return nil
+	})
+
+	calls := 0
+	handled := make(chan struct{})
+	m.StartConsumer(func(body []byte) error {
+		calls++
+		if calls <= 3 {
+			return ErrBusy
+		}
+		close(handled)
+		return nil
+	})
+	if err := m.Publish(context.Background(), "p", nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	select {
+	case <-handled:
+	case dl := <-deadLetters:
+		t.Fatalf("busy message dead-lettered after %d attempts", dl.Attempts)
+	case <-time.After(time.Second):
+		t.Fatal("busy message was not redelivered")
+	}
+}
@@ -0,0 +1,19 @@
+package mq
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus 指标，通过 /metrics 暴露
+var (
+	mqConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "forum_mq_connected",
+		Help: "RabbitMQ 连接状态 (1 已连接，0 断开)",
+	})
+
+	mqReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "forum_mq_reconnects_total",
+		Help: "RabbitMQ 断线重连成功的次数",
+	})
+)
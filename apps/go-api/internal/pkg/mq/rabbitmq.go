@@ -2,88 +2,331 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"go-api/internal/config"
+
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+const (
+	headerRetryCount = "x-retry-count" // 已重试次数
+	headerLastError  = "x-last-error"  // 最近一次处理失败的原因
+
+	// 断线重连的退避区间
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// ErrNotConnected 连接断开、正在重连中
+var ErrNotConnected = errors.New("mq: rabbitmq not connected")
+
+// IsUnavailable 投递失败是因为 MQ 不可用 (断线重连中、连接被关闭、投递超时)，和消息本身无关，等 MQ 恢复后重投即可
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, amqp.ErrClosed) ||
+		errors.Is(err, ErrBrokerClosed) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// RabbitMQ 队列拓扑：
+//
+//	<exchange>              topic 交换机，routing key 是 pattern
+//	<worker>                Go worker 的主队列，绑定 "#" (所有 pattern)，手动 ack
+//	<worker>.retry.<delay>  延迟重试队列 (每个重试级别一个，TTL 到期后死信回主队列)
+//	<worker>.dlx            死信交换机 (fanout)
+//	<worker>.dlq            死信队列，绑定到死信交换机
+//	<nest>                  NestJS 监听的队列，只绑定 NestPatterns；重试和死信由 NestJS 自己处理
 type RabbitMQ struct {
+	queueName string // Go worker 的队列
+	nestQueue string
+	exchange  string
+	url       string
+
+	maxRetries int
+	retryBase  time.Duration
+	prefetch   int
+
+	// 断线重连时 conn/channel 会被替换，读写都要加锁
+	mu        sync.RWMutex
 	conn      *amqp.Connection
 	channel   *amqp.Channel
-	queueName string
-	url       string
+	handler   Handler           // 记住已注册的消费者，重连后自动恢复
+	dlHandler DeadLetterHandler // 同上
+
+	connected atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func NewRabbitMQ(url string, queueName string) (*RabbitMQ, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
+// NewRabbitMQ 建立连接并声明队列拓扑
+// 首次连接失败直接返回错误 (由调用方决定是否降级)；之后断线会在后台自动重连
+func NewRabbitMQ(cfg config.RabbitMQConfig) (*RabbitMQ, error) {
+	r := &RabbitMQ{
+		queueName:  cfg.WorkerQueue,
+		nestQueue:  cfg.QueueName,
+		exchange:   cfg.Exchange,
+		url:        cfg.URL,
+		maxRetries: cfg.MaxRetries,
+		retryBase:  cfg.RetryBaseDelay,
+		prefetch:   cfg.Prefetch,
+		done:       make(chan struct{}),
+	}
+	if err := r.connect(); err != nil {
 		return nil, err
 	}
 
+	go r.watch()
+	return r, nil
+}
+
+// connect 建立连接和 channel，声明拓扑，成功后替换当前连接
+func (r *RabbitMQ) connect() error {
+	conn, err := amqp.Dial(r.url)
+	if err != nil {
+		return err
+	}
+
 	ch, err := conn.Channel()
 	if err != nil {
-		return nil, err
+		conn.Close()
+		return err
+	}
+
+	if err := r.declareTopology(ch); err != nil {
+		conn.Close()
+		return err
 	}
 
+	r.mu.Lock()
+	r.conn = conn
+	r.channel = ch
+	r.mu.Unlock()
+
+	r.setConnected(true)
+	return nil
+}
+
+// watch 监听连接/channel 关闭事件，断开后按指数退避重连，并恢复消费者
+func (r *RabbitMQ) watch() {
+	for {
+		r.mu.RLock()
+		connClosed := r.conn.NotifyClose(make(chan *amqp.Error, 1))
+		chanClosed := r.channel.NotifyClose(make(chan *amqp.Error, 1))
+		conn := r.conn
+		r.mu.RUnlock()
+
+		select {
+		case <-r.done:
+			return
+		case err := <-connClosed:
+			slog.Error("⚠️ RabbitMQ connection closed", "err", err)
+		case err := <-chanClosed:
+			// channel 级别的异常 (连接还活着)，直接关掉连接走完整的重连流程
+			slog.Error("⚠️ RabbitMQ channel closed", "err", err)
+			conn.Close()
+		}
+		r.setConnected(false)
+
+		if !r.reconnect() {
+			return
+		}
+		r.resumeConsumers()
+	}
+}
+
+// reconnect 一直重试直到成功，或者 Close 被调用 (返回 false)
+func (r *RabbitMQ) reconnect() bool {
+	delay := reconnectMinDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-r.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		err := r.connect()
+		if err == nil {
+			mqReconnects.Inc()
+			slog.Info("✅ RabbitMQ reconnected", "attempt", attempt)
+			return true
+		}
+		slog.Error("❌ RabbitMQ reconnect failed", "attempt", attempt, "retry_in", delay, "err", err)
+
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// resumeConsumers 重连后重新注册之前的消费者
+func (r *RabbitMQ) resumeConsumers() {
+	r.mu.RLock()
+	handler, dlHandler := r.handler, r.dlHandler
+	r.mu.RUnlock()
+
+	if handler != nil {
+		r.consume(handler)
+	}
+	if dlHandler != nil {
+		r.consumeDeadLetters(dlHandler)
+	}
+}
+
+// Connected 当前是否已连接 (健康检查用)
+func (r *RabbitMQ) Connected() bool {
+	return r.connected.Load()
+}
+
+func (r *RabbitMQ) setConnected(ok bool) {
+	r.connected.Store(ok)
+	if ok {
+		mqConnected.Set(1)
+	} else {
+		mqConnected.Set(0)
+	}
+}
+
+// currentChannel 取当前可用的 channel
+func (r *RabbitMQ) currentChannel() (*amqp.Channel, error) {
+	if !r.Connected() {
+		return nil, ErrNotConnected
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.channel, nil
+}
+
+// declareTopology 声明主队列、重试队列和死信队列 (幂等，重连后会重新执行)
+func (r *RabbitMQ) declareTopology(ch *amqp.Channel) error {
 	// 声明队列 (确保队列存在)
-	_, err = ch.QueueDeclare(
-		queueName, // 队列名
-		true,      // durable (持久化)
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
+	// 注意：主队列不加 x-dead-letter 参数，否则和已存在的旧队列参数不一致会声明失败
+	_, err := ch.QueueDeclare(
+		r.queueName, // 队列名
+		true,        // durable (持久化)
+		false,       // delete when unused
+		false,       // exclusive
+		false,       // no-wait
+		nil,         // arguments
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &RabbitMQ{
-		conn:      conn,
-		channel:   ch,
-		queueName: queueName,
-	}, nil
-}
+	// NestJS 的队列参数要和 apps/api main.ts 里声明的一致 (durable，没有其它参数)
+	if _, err := ch.QueueDeclare(r.nestQueue, true, false, false, false, nil); err != nil {
+		return err
+	}
 
-func (r *RabbitMQ) PublishNewPost(postID uint, title string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// 按 pattern 路由：Go worker 收所有消息，NestJS 只收它处理的
+	if err := ch.ExchangeDeclare(r.exchange, "topic", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(r.queueName, "#", r.exchange, false, nil); err != nil {
+		return err
+	}
+	for _, pattern := range NestPatterns {
+		if err := ch.QueueBind(r.nestQueue, pattern, r.exchange, false, nil); err != nil {
+			return err
+		}
+	}
 
-	body, _ := json.Marshal(map[string]interface{}{
-		"pattern": "post_created", // NestJS Microservice 默认匹配模式
-		"data": map[string]interface{}{
-			"postId": postID,
-			"title":  title,
-			"time":   time.Now(),
-		},
-	})
-
-	err := r.channel.PublishWithContext(ctx,
-		"",          // exchange
-		r.queueName, // routing key (队列名)
-		false,       // mandatory
-		false,       // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
+	// 延迟重试队列：没有消费者，消息 TTL 到期后经默认交换机回到主队列
+	// 队列名带上延迟时间，修改退避配置后会声明新的队列，不会和旧队列参数冲突
+	for attempt := 1; attempt <= r.maxRetries; attempt++ {
+		delay := retryDelay(r.retryBase, attempt)
+		_, err := ch.QueueDeclare(r.retryQueue(attempt), true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": r.queueName,
 		})
+		if err != nil {
+			return err
+		}
+	}
 
+	// 死信交换机 + 死信队列
+	if err := ch.ExchangeDeclare(r.deadLetterExchange(), "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(r.deadLetterQueue(), true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(r.deadLetterQueue(), "", r.deadLetterExchange(), false, nil); err != nil {
+		return err
+	}
+
+	// 限制未 ack 的消息数量，避免一次性把队列拉到内存里
+	return ch.Qos(r.prefetch, 0, false)
+}
+
+// Publish 按 NestJS Microservice 的消息格式 ({pattern, data}) 投递到交换机，由绑定决定进哪些队列
+// 一次投递同时路由到两个队列，不会出现只进了一个的情况
+func (r *RabbitMQ) Publish(ctx context.Context, pattern string, data interface{}) error {
+	body, err := encode(pattern, data)
 	if err != nil {
-		slog.Info("❌ RabbitMQ Publish Failed:", "err", err)
 		return err
 	}
-	slog.Info("✅ RabbitMQ Sent:", "title", title)
+
+	if err := r.publishRaw(ctx, r.exchange, pattern, body, nil); err != nil {
+		slog.Info("❌ RabbitMQ Publish Failed:", "pattern", pattern, "err", err)
+		return err
+	}
+	slog.Info("✅ RabbitMQ Sent:", "pattern", pattern)
 	return nil
 }
 
-// 消费方法
-func (r *RabbitMQ) StartConsumer(handler func(msg []byte)) {
-	msgs, err := r.channel.Consume(
+// Replay 死信来自 Go worker 的队列，直接投回这个队列 (不经过交换机，NestJS 不会再收到一次)
+func (r *RabbitMQ) Replay(ctx context.Context, body []byte) error {
+	return r.publishRaw(ctx, "", r.queueName, body, nil)
+}
+
+func (r *RabbitMQ) publishRaw(ctx context.Context, exchange, routingKey string, body []byte, headers amqp.Table) error {
+	ch, err := r.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return ch.PublishWithContext(ctx,
+		exchange,   // exchange
+		routingKey, // routing key (队列名)
+		false,      // mandatory
+		false,      // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Headers:      headers,
+			Body:         body,
+		})
+}
+
+// 消费方法 (手动 ack)，断线重连后会自动恢复
+func (r *RabbitMQ) StartConsumer(handler Handler) {
+	r.mu.Lock()
+	r.handler = handler
+	r.mu.Unlock()
+
+	r.consume(handler)
+}
+
+func (r *RabbitMQ) consume(handler Handler) {
+	ch, err := r.currentChannel()
+	if err != nil {
+		slog.Info("❌ Failed to register a consumer:", "err", err)
+		return
+	}
+
+	msgs, err := ch.Consume(
 		r.queueName, // 队列名
 		"",          // consumer name (留空自动生成)
-		true,        // auto-ack (自动确认收到)
+		false,       // auto-ack (关闭，处理成功后再手动确认)
 		false,       // exclusive
 		false,       // no-local
 		false,       // no-wait
@@ -94,17 +337,141 @@ func (r *RabbitMQ) StartConsumer(handler func(msg []byte)) {
 		return
 	}
 
-	// 开启一个协程一直从 channel 里读数据
+	// 开启一个协程一直从 channel 里读数据 (连接断开时 msgs 会被关闭，协程退出，重连后重新注册)
+	// 每条消息单独一个协程处理，未 ack 的消息数受 prefetch 限制，所以并发也不会超过 prefetch
 	go func() {
 		slog.Info("🎧 RabbitMQ Consumer Started... Waiting for messages.")
 		for d := range msgs {
-			// 调用传入的处理函数
-			handler(d.Body)
+			go r.handleDelivery(d, handler)
 		}
+		slog.Info("🔌 RabbitMQ Consumer Stopped.")
 	}()
 }
 
-func (r *RabbitMQ) Close() {
+// handleDelivery 调用处理函数，并根据结果 ack / 转入重试队列 / 转入死信
+// 转投成功后才 ack 原消息；转投失败则 nack 放回主队列，保证消息不丢
+func (r *RabbitMQ) handleDelivery(d amqp.Delivery, handler Handler) {
+	err := handler(d.Body)
+	if err == nil {
+		d.Ack(false)
+		return
+	}
+
+	ctx := context.Background()
+	attempts := retryCount(d.Headers)
+
+	if errors.Is(err, ErrBusy) {
+		// 放进最短的延迟队列，原样带上重试次数；直接 requeue 会立刻又投递回来，空转
+		if pubErr := r.publishRaw(ctx, "", r.retryQueue(1), d.Body, d.Headers); pubErr != nil {
+			slog.Error("❌ RabbitMQ Requeue Busy Failed:", "err", pubErr)
+			d.Nack(false, true)
+			return
+		}
+		d.Ack(false)
+		return
+	}
+
+	if !IsPermanent(err) && attempts < r.maxRetries {
+		next := attempts + 1
+		slog.Info("🔁 RabbitMQ Retry:", "attempt", next, "queue", r.retryQueue(next), "err", err)
+		if pubErr := r.publishRaw(ctx, "", r.retryQueue(next), d.Body, amqp.Table{
+			headerRetryCount: int32(next),
+			headerLastError:  err.Error(),
+		}); pubErr != nil {
+			slog.Error("❌ RabbitMQ Retry Publish Failed:", "err", pubErr)
+			d.Nack(false, true)
+			return
+		}
+		d.Ack(false)
+		return
+	}
+
+	slog.Error("☠️ RabbitMQ Dead Letter:", "attempts", attempts, "err", err)
+	if pubErr := r.publishRaw(ctx, r.deadLetterExchange(), "", d.Body, amqp.Table{
+		headerRetryCount: int32(attempts),
+		headerLastError:  err.Error(),
+	}); pubErr != nil {
+		slog.Error("❌ RabbitMQ Dead Letter Publish Failed:", "err", pubErr)
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
+
+// StartDeadLetterConsumer 消费死信队列，交给 handler (通常是落库)
+func (r *RabbitMQ) StartDeadLetterConsumer(handler DeadLetterHandler) {
+	r.mu.Lock()
+	r.dlHandler = handler
+	r.mu.Unlock()
+
+	r.consumeDeadLetters(handler)
+}
+
+func (r *RabbitMQ) consumeDeadLetters(handler DeadLetterHandler) {
+	ch, err := r.currentChannel()
+	if err != nil {
+		slog.Info("❌ Failed to register a dead letter consumer:", "err", err)
+		return
+	}
+
+	msgs, err := ch.Consume(r.deadLetterQueue(), "", false, false, false, false, nil)
+	if err != nil {
+		slog.Info("❌ Failed to register a dead letter consumer:", "err", err)
+		return
+	}
+
+	go func() {
+		slog.Info("🎧 RabbitMQ Dead Letter Consumer Started...")
+		for d := range msgs {
+			lastError, _ := d.Headers[headerLastError].(string)
+			if err := handler(DeadLetter{
+				Body:     d.Body,
+				Error:    lastError,
+				Attempts: retryCount(d.Headers),
+			}); err != nil {
+				slog.Error("❌ Dead Letter Handler Failed:", "err", err)
+				time.Sleep(time.Second) // 避免落库失败时疯狂重投
+				d.Nack(false, true)
+				continue
+			}
+			d.Ack(false)
+		}
+	}()
+}
+
+// Close 停止重连并关闭连接
+func (r *RabbitMQ) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	r.setConnected(false)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	r.channel.Close()
-	r.conn.Close()
+	return r.conn.Close()
+}
+
+func (r *RabbitMQ) retryQueue(attempt int) string {
+	return fmt.Sprintf("%s.retry.%dms", r.queueName, retryDelay(r.retryBase, attempt).Milliseconds())
+}
+
+func (r *RabbitMQ) deadLetterExchange() string {
+	return r.queueName + ".dlx"
+}
+
+func (r *RabbitMQ) deadLetterQueue() string {
+	return r.queueName + ".dlq"
+}
+
+// retryCount 从消息头读取已重试次数
+func retryCount(headers amqp.Table) int {
+	switch v := headers[headerRetryCount].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
 }
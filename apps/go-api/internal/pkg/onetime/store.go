@@ -0,0 +1,106 @@
+package onetime
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"go-api/internal/consts"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidToken 令牌不存在、已过期或已被使用
+var ErrInvalidToken = errors.New("onetime: invalid or expired token")
+
+// Store 一次性令牌 (邮箱验证、重置密码等)
+// Redis 里只存令牌的哈希，取出即删除，保证只能用一次
+type Store struct {
+	rdb     *redis.Client
+	purpose string
+	ttl     time.Duration
+}
+
+func NewStore(rdb *redis.Client, purpose string, ttl time.Duration) *Store {
+	return &Store{
+		rdb:     rdb,
+		purpose: purpose,
+		ttl:     ttl,
+	}
+}
+
+// TTL 令牌有效期 (邮件文案里可能要用)
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue 为用户生成新令牌，返回明文 (只会出现在邮件链接里)
+// 同时把哈希记到用户名下，RevokeAll 时一次作废
+func (s *Store) Issue(ctx context.Context, userID uint) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	h := hash(token)
+
+	userKey := consts.CacheKeyOneTimeUserTokens(s.purpose, userID)
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, consts.CacheKeyOneTimeToken(s.purpose, h), userID, s.ttl)
+	pipe.SAdd(ctx, userKey, h)
+	pipe.Expire(ctx, userKey, s.ttl) // 最后一个令牌过期时整个 Set 也过期
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeAll 作废用户名下所有还没用掉的令牌 (比如重置密码成功后，其它重置链接都不能再用)
+func (s *Store) RevokeAll(ctx context.Context, userID uint) error {
+	userKey := consts.CacheKeyOneTimeUserTokens(s.purpose, userID)
+	hashes, err := s.rdb.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	for _, h := range hashes {
+		pipe.Del(ctx, consts.CacheKeyOneTimeToken(s.purpose, h))
+	}
+	pipe.Del(ctx, userKey)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Consume 校验并作废令牌，返回对应的用户 ID
+func (s *Store) Consume(ctx context.Context, token string) (uint, error) {
+	if token == "" {
+		return 0, ErrInvalidToken
+	}
+
+	val, err := s.rdb.GetDel(ctx, consts.CacheKeyOneTimeToken(s.purpose, hash(token))).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	// 令牌已经作废，用户名下的记录删不掉也没关系 (RevokeAll 删一个不存在的 key 不影响)
+	s.rdb.SRem(ctx, consts.CacheKeyOneTimeUserTokens(s.purpose, uint(userID)), hash(token))
+	return uint(userID), nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,136 @@
+package onetime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestStore(t *testing.T, purpose string) (*Store, *miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewStore(rdb, purpose, 30*time.Minute), mr, rdb
+}
+
+func TestConsume(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestStore(t, "reset_password")
+
+	token, err := s.Issue(ctx, 42)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantID  uint
+		wantErr error
+	}{
+		{"valid token", token, 42, nil},
+		{"used twice", token, 0, ErrInvalidToken},
+		{"empty", "", 0, ErrInvalidToken},
+		{"unknown", "not-a-token", 0, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := s.Consume(ctx, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Consume err = %v, want %v", err, tt.wantErr)
+			}
+			if id != tt.wantID {
+				t.Errorf("Consume id = %d, want %d", id, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestConsumeExpired(t *testing.T) {
+	ctx := context.Background()
+	s, mr, _ := newTestStore(t, "verify_email")
+
+	token, err := s.Issue(ctx, 1)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	mr.FastForward(s.TTL() + time.Second)
+	if _, err := s.Consume(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Consume expired = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestPurposesAreIsolated(t *testing.T) {
+	ctx := context.Background()
+	verify, _, rdb := newTestStore(t, "verify_email")
+	reset := NewStore(rdb, "reset_password", time.Hour)
+
+	token, err := verify.Issue(ctx, 1)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	// 验证邮箱的令牌不能拿来重置密码
+	if _, err := reset.Consume(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("cross-purpose Consume = %v, want ErrInvalidToken", err)
+	}
+	if id, err := verify.Consume(ctx, token); err != nil || id != 1 {
+		t.Fatalf("Consume = %d, %v; want 1, nil", id, err)
+	}
+}
+
+func TestRedisKeepsOnlyHash(t *testing.T) {
+	ctx := context.Background()
+	s, mr, _ := newTestStore(t, "reset_password")
+
+	token, err := s.Issue(ctx, 1)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	for _, key := range mr.Keys() {
+		if strings.Contains(key, token) {
+			t.Fatalf("plain token stored in redis key: %s", key)
+		}
+	}
+}
+
+func TestRevokeAll(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestStore(t, "reset_password")
+
+	first, _ := s.Issue(ctx, 7)
+	second, _ := s.Issue(ctx, 7)
+	other, _ := s.Issue(ctx, 8)
+
+	if err := s.RevokeAll(ctx, 7); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"first token of revoked user", first, ErrInvalidToken},
+		{"second token of revoked user", second, ErrInvalidToken},
+		{"token of another user", other, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Consume(ctx, tt.token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Consume = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 作废之后新签发的令牌照常可用
+	fresh, _ := s.Issue(ctx, 7)
+	if id, err := s.Consume(ctx, fresh); err != nil || id != 7 {
+		t.Fatalf("Consume fresh = %d, %v; want 7, nil", id, err)
+	}
+}
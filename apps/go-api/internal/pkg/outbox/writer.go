@@ -0,0 +1,40 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Writer 把消息写进 Outbox 表，实现了 mq.Publisher
+// 传入业务事务的 tx，消息就会和业务数据一起提交或回滚：
+//
+//	db.Transaction(func(tx *gorm.DB) error {
+//		tx.Create(&post)
+//		return mq.PublishNewPost(ctx, outbox.NewWriter(tx), post.ID, post.AuthorID, post.Title)
+//	})
+type Writer struct {
+	tx *gorm.DB
+}
+
+func NewWriter(tx *gorm.DB) *Writer {
+	return &Writer{tx: tx}
+}
+
+func (w *Writer) Publish(ctx context.Context, pattern string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return w.tx.WithContext(ctx).Create(&models.OutboxEvent{
+		Pattern:       pattern,
+		Payload:       string(payload),
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
@@ -0,0 +1,60 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultLimit = 20  // 默认每页条数
+	MaxLimit     = 100 // 单页上限，防止一次拉取过多
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidLimit  = errors.New("invalid limit")
+)
+
+// Cursor 键集分页的位置 (createdAt + id)
+// 对前端来说是不透明的字符串，不要让前端自己拼
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"id"`
+}
+
+// Encode 把游标编码成 URL 安全的字符串
+func Encode(c Cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Decode 解析前端传回来的游标
+func Decode(s string) (Cursor, error) {
+	var c Cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == 0 || c.CreatedAt.IsZero() {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ParseLimit 解析每页条数，空值返回默认值，超过上限按上限处理
+func ParseLimit(s string) (int, error) {
+	if s == "" {
+		return DefaultLimit, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, ErrInvalidLimit
+	}
+	if n > MaxLimit {
+		n = MaxLimit
+	}
+	return n, nil
+}
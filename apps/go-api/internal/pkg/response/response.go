@@ -13,6 +13,13 @@ type Response struct {
 	Data    interface{} `json:"data"`    // 成功时的返回数据
 }
 
+// PageData 游标分页的数据部分
+type PageData struct {
+	List       interface{} `json:"list"`       // 当前页数据
+	NextCursor string      `json:"nextCursor"` // 下一页游标，没有更多时为空
+	HasMore    bool        `json:"hasMore"`    // 是否还有下一页
+}
+
 // Success 成功响应
 func Success(c *gin.Context, data interface{}) {
 	c.JSON(http.StatusOK, Response{
@@ -22,6 +29,11 @@ func Success(c *gin.Context, data interface{}) {
 	})
 }
 
+// SuccessPage 分页成功响应
+func SuccessPage(c *gin.Context, page PageData) {
+	Success(c, page)
+}
+
 // Fail 失败响应
 func Fail(c *gin.Context, httpStatus int, code int, msg string) {
 	c.JSON(httpStatus, Response{
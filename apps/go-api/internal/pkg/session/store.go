@@ -0,0 +1,241 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/consts"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrInvalidToken refresh token 格式错误、已过期或 session 已不存在
+	ErrInvalidToken = errors.New("session: invalid refresh token")
+	// ErrTokenReused 旧的 refresh token 被再次使用，整个 session 已被吊销
+	ErrTokenReused = errors.New("session: refresh token reused")
+)
+
+// Session 一次登录对应一个 session，refresh token 轮换时 ID 不变 (同一个 family)
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      uint      `json:"userId"`
+	RefreshHash string    `json:"refreshHash"` // 只存哈希，Redis 泄露也拿不到可用的 token
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// Store 基于 Redis 的 session 存储
+// 每个用户一个 Hash (consts.CacheKeyUserSession)，field 是 sessionID
+type Store struct {
+	rdb        *redis.Client
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	maxAccess  time.Duration // 所有 access token 里最长的有效期 (NestJS 签发的比 Go 的长)
+}
+
+// NewStore maxTokenTTL 是所有签发方 access token 的最长有效期，用户级吊销记录至少要保留这么久
+func NewStore(rdb *redis.Client, accessTTL, refreshTTL, maxTokenTTL time.Duration) *Store {
+	return &Store{
+		rdb:        rdb,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		maxAccess:  max(accessTTL, maxTokenTTL),
+	}
+}
+
+// Create 登录时创建新 session，返回 session 和首个 refresh token
+func (s *Store) Create(ctx context.Context, userID uint) (*Session, string, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	sess := &Session{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		RefreshHash: hashSecret(secret),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.refreshTTL),
+	}
+	if err := s.save(ctx, s.rdb, sess); err != nil {
+		return nil, "", err
+	}
+
+	return sess, formatToken(userID, sess.ID, secret), nil
+}
+
+// Rotate 用 refresh token 换一个新的 refresh token (旧的立即作废)
+// 如果拿来的是已经轮换掉的旧 token，说明 token 可能泄露，直接吊销整个 session
+func (s *Store) Rotate(ctx context.Context, refreshToken string) (*Session, string, error) {
+	userID, sid, secret, err := parseToken(refreshToken)
+	if err != nil {
+		return nil, "", ErrInvalidToken
+	}
+
+	key := consts.CacheKeyUserSession(userID)
+	var (
+		sess      Session
+		newSecret string
+		reused    bool
+	)
+
+	// WATCH 保证并发刷新时只有一个请求能轮换成功
+	err = s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		raw, err := tx.HGet(ctx, key, sid).Result()
+		if errors.Is(err, redis.Nil) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+			return ErrInvalidToken
+		}
+		if time.Now().After(sess.ExpiresAt) {
+			tx.HDel(ctx, key, sid)
+			return ErrInvalidToken
+		}
+		if sess.RefreshHash != hashSecret(secret) {
+			reused = true
+			return ErrTokenReused
+		}
+
+		if newSecret, err = randomSecret(); err != nil {
+			return err
+		}
+		sess.RefreshHash = hashSecret(newSecret)
+		sess.ExpiresAt = time.Now().Add(s.refreshTTL)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return s.save(ctx, pipe, &sess)
+		})
+		return err
+	}, key)
+
+	if reused {
+		if err := s.Revoke(ctx, userID, sid); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrTokenReused
+	}
+	if errors.Is(err, redis.TxFailedErr) {
+		// 同一个 token 的另一个并发请求已经轮换成功
+		return nil, "", ErrInvalidToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &sess, formatToken(userID, sid, newSecret), nil
+}
+
+// Revoke 注销单个 session：删除 refresh token，并把 sessionID 加入吊销名单
+// 吊销名单的存活时间与 access token 一致，过期后旧 access token 自然也失效了
+func (s *Store) Revoke(ctx context.Context, userID uint, sid string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.HDel(ctx, consts.CacheKeyUserSession(userID), sid)
+	pipe.Set(ctx, consts.CacheKeyRevokedSession(sid), 1, s.accessTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RevokeAll 注销用户的所有 session (改密码、账号被盗等场景)
+// 同时记录吊销时间点 (毫秒)，连不带 sessionID 的 token (比如 NestJS 签发的) 也一并失效
+// 吊销时间点要保留到最长的 access token 过期之后，否则 NestJS 的 24h token 会在记录过期后重新生效
+func (s *Store) RevokeAll(ctx context.Context, userID uint) error {
+	key := consts.CacheKeyUserSession(userID)
+	sids, err := s.rdb.HKeys(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	for _, sid := range sids {
+		pipe.Set(ctx, consts.CacheKeyRevokedSession(sid), 1, s.accessTTL)
+	}
+	pipe.Del(ctx, key)
+	pipe.Set(ctx, consts.CacheKeyUserRevokedBefore(userID), time.Now().UnixMilli(), s.maxAccess)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// IsRevoked 校验 access token 是否已被吊销 (一次 MGET 完成)
+// JWT 的 iat 只精确到秒，和吊销同一秒签发的 token 分不清先后，按已吊销处理 (<=)
+func (s *Store) IsRevoked(ctx context.Context, userID uint, sid string, issuedAt time.Time) (bool, error) {
+	keys := []string{consts.CacheKeyUserRevokedBefore(userID)}
+	if sid != "" {
+		keys = append(keys, consts.CacheKeyRevokedSession(sid))
+	}
+
+	vals, err := s.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if v, ok := vals[0].(string); ok {
+		before, _ := strconv.ParseInt(v, 10, 64)
+		if issuedAt.UnixMilli() <= before {
+			return true, nil
+		}
+	}
+	if len(vals) > 1 && vals[1] != nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+// save 写入 session 并顺延整个 Hash 的过期时间
+func (s *Store) save(ctx context.Context, cmd redis.Cmdable, sess *Session) error {
+	raw, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	key := consts.CacheKeyUserSession(sess.UserID)
+	if err := cmd.HSet(ctx, key, sess.ID, raw).Err(); err != nil {
+		return err
+	}
+	return cmd.Expire(ctx, key, s.refreshTTL).Err()
+}
+
+// refresh token 格式：<userID>.<sessionID>.<secret>
+// 前两段用于定位 session，secret 才是真正的凭证
+func formatToken(userID uint, sid, secret string) string {
+	return fmt.Sprintf("%d.%s.%s", userID, sid, secret)
+}
+
+func parseToken(token string) (uint, string, string, error) {
+	parts := strings.SplitN(token, ".", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return 0, "", "", ErrInvalidToken
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", "", ErrInvalidToken
+	}
+	return uint(userID), parts[1], parts[2], nil
+}
+
+func randomSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,150 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-api/internal/consts"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	testAccessTTL  = 15 * time.Minute
+	testRefreshTTL = 7 * 24 * time.Hour
+	testNestTTL    = 24 * time.Hour
+)
+
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewStore(rdb, testAccessTTL, testRefreshTTL, testNestTTL), mr
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t)
+
+	sess, token, err := s.Create(ctx, 42)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	rotated, next, err := s.Rotate(ctx, token)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if rotated.ID != sess.ID {
+		t.Errorf("session id changed: %s -> %s", sess.ID, rotated.ID)
+	}
+	if next == token {
+		t.Error("rotate returned the same token")
+	}
+
+	// 旧 token 再用一次：视为泄露，整个 session 被吊销，新 token 也不能用了
+	if _, _, err := s.Rotate(ctx, token); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("reuse old token: got %v, want ErrTokenReused", err)
+	}
+	if _, _, err := s.Rotate(ctx, next); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("rotate after reuse: got %v, want ErrInvalidToken", err)
+	}
+	revoked, err := s.IsRevoked(ctx, 42, sess.ID, time.Now())
+	if err != nil || !revoked {
+		t.Fatalf("IsRevoked after reuse = %v, %v; want true", revoked, err)
+	}
+}
+
+func TestRotateInvalidToken(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"missing secret", "42.sid."},
+		{"bad user id", "abc.sid.secret"},
+		{"unknown session", "42.unknown.secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.Rotate(ctx, tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Rotate(%q) = %v, want ErrInvalidToken", tt.token, err)
+			}
+		})
+	}
+}
+
+func TestIsRevokedAfterRevokeAll(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestStore(t)
+
+	sess, _, err := s.Create(ctx, 7)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := s.RevokeAll(ctx, 7); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	// iat 只精确到秒，按 JWT 的方式截断
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		userID   uint
+		sid      string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"go token of revoked session", 7, sess.ID, now.Add(-time.Minute), true},
+		{"nest token issued before revoke", 7, "", now.Add(-time.Minute), true},
+		{"nest token issued in the same second", 7, "", now, true},
+		{"nest token issued after revoke", 7, "", now.Add(2 * time.Second), false},
+		{"other user", 8, "", now.Add(-time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.IsRevoked(ctx, tt.userID, tt.sid, tt.issuedAt)
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsRevoked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 吊销记录要活得比 NestJS 的 24h token 久
+	if ttl := mr.TTL(consts.CacheKeyUserRevokedBefore(7)); ttl < testNestTTL {
+		t.Errorf("revoked-before marker ttl = %s, want >= %s", ttl, testNestTTL)
+	}
+	mr.FastForward(testAccessTTL + time.Minute)
+	if got, _ := s.IsRevoked(ctx, 7, "", now.Add(-time.Minute)); !got {
+		t.Error("nest token became valid again after the access ttl passed")
+	}
+}
+
+func TestRevokeSingleSession(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t)
+
+	a, _, _ := s.Create(ctx, 1)
+	b, _, _ := s.Create(ctx, 1)
+	if err := s.Revoke(ctx, 1, a.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	issued := time.Now().Add(-time.Minute)
+	if got, _ := s.IsRevoked(ctx, 1, a.ID, issued); !got {
+		t.Error("revoked session still valid")
+	}
+	if got, _ := s.IsRevoked(ctx, 1, b.ID, issued); got {
+		t.Error("other session of the same user was revoked")
+	}
+}
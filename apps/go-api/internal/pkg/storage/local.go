@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/config"
+)
+
+// metaDir 元信息 (Content-Type) 存放目录，以 . 开头的 key 不合法，所以不会和对象冲突
+const metaDir = ".meta"
+
+var (
+	// ErrInvalidKey key 为空、包含 .. 或者以 . 开头的路径段
+	ErrInvalidKey = errors.New("storage: invalid object key")
+	// ErrInvalidSignature 预签名地址的签名错误或已过期
+	ErrInvalidSignature = errors.New("storage: invalid or expired signature")
+)
+
+// LocalBackend 本地磁盘实现，只用于开发和测试
+// 文件通过 API 的 /uploads/*key 路由访问和直传，预签名地址带 HMAC 签名和过期时间
+type LocalBackend struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+type localMeta struct {
+	ContentType string `json:"contentType"`
+}
+
+func NewLocalBackend(cfg config.StorageConfig) (*LocalBackend, error) {
+	if cfg.LocalDir == "" {
+		return nil, errors.New("storage: local dir is empty")
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.LocalDir, metaDir), 0o755); err != nil {
+		return nil, fmt.Errorf("storage: create local dir: %w", err)
+	}
+	return &LocalBackend{
+		dir:     cfg.LocalDir,
+		baseURL: strings.TrimRight(cfg.LocalBaseURL, "/"),
+		secret:  []byte(cfg.SignSecret),
+	}, nil
+}
+
+// Put 先写临时文件再 rename，读的一方不会看到写了一半的文件
+func (l *LocalBackend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	target := l.objectPath(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // rename 成功之后这里删不到任何东西
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := l.writeMeta(key, localMeta{ContentType: contentType}); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (l *LocalBackend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	info, err := l.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(l.objectPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+func (l *LocalBackend) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	if err := os.Remove(l.objectPath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(l.metaPath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalBackend) Copy(ctx context.Context, src, dst string) error {
+	body, info, err := l.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return l.Put(ctx, dst, body, info.Size, info.ContentType)
+}
+
+func (l *LocalBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	fi, err := os.Stat(l.objectPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	info := &ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()}
+	if meta, err := l.readMeta(key); err == nil {
+		info.ContentType = meta.ContentType
+	}
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
+	}
+	return info, nil
+}
+
+// DeleteExpired 遍历 prefix 对应的目录，跳过正在写入的临时文件 (以 . 开头)
+func (l *LocalBackend) DeleteExpired(ctx context.Context, prefix string, before time.Time) (int, error) {
+	root := l.objectPath(strings.TrimSuffix(prefix, "/"))
+	var n int
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == root {
+			return nil // 还没有写过这个前缀
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !fi.ModTime().Before(before) {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		if err := l.Delete(ctx, filepath.ToSlash(rel)); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// PresignGet 生成 {baseURL}/{key}?expires=...&signature=... 形式的地址
+func (l *LocalBackend) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", l.sign(http.MethodGet, key, expires))
+	return l.baseURL + "/" + key + "?" + q.Encode(), nil
+}
+
+// PresignPut 直传地址和下载地址相同，签名里额外包含类型和大小，由 API 的 PUT /uploads/*key 接收
+func (l *LocalBackend) PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (*PresignedRequest, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", l.sign(http.MethodPut, key, expires, contentType, strconv.FormatInt(size, 10)))
+	return &PresignedRequest{
+		Method: http.MethodPut,
+		URL:    l.baseURL + "/" + key + "?" + q.Encode(),
+		Headers: map[string]string{
+			"Content-Type":   contentType,
+			"Content-Length": strconv.FormatInt(size, 10),
+		},
+	}, nil
+}
+
+// VerifyGet 校验 PresignGet 生成的签名
+func (l *LocalBackend) VerifyGet(key, expires, signature string) error {
+	return l.verify(signature, expires, http.MethodGet, key, expires)
+}
+
+// VerifyPut 校验 PresignPut 生成的签名，contentType 和 size 取自实际的上传请求
+func (l *LocalBackend) VerifyPut(key, contentType string, size int64, expires, signature string) error {
+	return l.verify(signature, expires, http.MethodPut, key, expires, contentType, strconv.FormatInt(size, 10))
+}
+
+func (l *LocalBackend) verify(signature, expires string, parts ...string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(l.sign(parts...))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// sign 对 方法、key、过期时间 (以及上传的类型和大小) 签名，下载地址不能拿来上传
+func (l *LocalBackend) sign(parts ...string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (l *LocalBackend) objectPath(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(key))
+}
+
+func (l *LocalBackend) metaPath(key string) string {
+	return filepath.Join(l.dir, metaDir, filepath.FromSlash(key)+".json")
+}
+
+func (l *LocalBackend) writeMeta(key string, meta localMeta) error {
+	p := l.metaPath(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, raw, 0o644)
+}
+
+func (l *LocalBackend) readMeta(key string) (localMeta, error) {
+	var meta localMeta
+	raw, err := os.ReadFile(l.metaPath(key))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(raw, &meta)
+	return meta, err
+}
+
+// validKey key 来自 URL 时也要防止路径穿越：必须是干净的相对路径，且每一段都不以 . 开头
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return false
+		}
+	}
+	return true
+}
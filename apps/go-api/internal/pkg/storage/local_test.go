@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-api/internal/config"
+)
+
+func newTestLocal(t *testing.T) *LocalBackend {
+	t.Helper()
+	l, err := NewLocalBackend(config.StorageConfig{
+		LocalDir:     t.TempDir(),
+		LocalBaseURL: "http://localhost:8080/uploads/",
+		SignSecret:   "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	return l
+}
+
+func put(t *testing.T, l *LocalBackend, key, body string) {
+	t.Helper()
+	if err := l.Put(context.Background(), key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		t.Fatalf("Put %s: %v", key, err)
+	}
+}
+
+func read(t *testing.T, l *LocalBackend, key string) string {
+	t.Helper()
+	body, _, err := l.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get %s: %v", key, err)
+	}
+	defer body.Close()
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return string(raw)
+}
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"ab/abc.png", true},
+		{"private/staging/abc.png", true},
+		{"a", true},
+		{"", false},
+		{"../etc/passwd", false},
+		{"ab/../../etc/passwd", false},
+		{"ab/..", false},
+		{"/etc/passwd", false},
+		{"ab//abc.png", false},
+		{"ab/./abc.png", false},
+		{"ab/abc.png/", false},
+		{`ab\..\abc.png`, false},
+		{".meta/ab/abc.png.json", false},
+		{"ab/.upload-123", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := validKey(tt.key); got != tt.want {
+				t.Fatalf("validKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalRejectsInvalidKeys(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	outside := filepath.Join(filepath.Dir(l.dir), "escaped.txt")
+
+	for _, key := range []string{"../escaped.txt", "/tmp/escaped.txt"} {
+		if err := l.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put %q err = %v, want ErrInvalidKey", key, err)
+		}
+		if _, _, err := l.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get %q err = %v, want ErrInvalidKey", key, err)
+		}
+		if err := l.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete %q err = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := l.PresignGet(ctx, key, time.Minute); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("PresignGet %q err = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(outside); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file written outside the storage dir: %v", err)
+	}
+}
+
+func TestIsPrivate(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"private/staging/abc.png", true},
+		{"private/originals/ab/abc.png", true},
+		{"ab/abc.png", false},
+		{"ab/private/abc.png", false},
+		{"privatefile.png", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := IsPrivate(tt.key); got != tt.want {
+				t.Fatalf("IsPrivate(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalPutGetStat(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	put(t, l, "ab/abc.txt", "hello")
+
+	if got := read(t, l, "ab/abc.txt"); got != "hello" {
+		t.Fatalf("Get = %q, want %q", got, "hello")
+	}
+	info, err := l.Stat(ctx, "ab/abc.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != 5 || info.ContentType != "text/plain" {
+		t.Fatalf("Stat = {size %d, type %s}, want {5, text/plain}", info.Size, info.ContentType)
+	}
+
+	if _, err := l.Stat(ctx, "ab/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat missing err = %v, want ErrNotFound", err)
+	}
+	if _, err := l.Stat(ctx, "ab"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat directory err = %v, want ErrNotFound", err)
+	}
+
+	if err := l.Delete(ctx, "ab/abc.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := l.Delete(ctx, "ab/abc.txt"); err != nil {
+		t.Fatalf("Delete twice: %v", err) // 对象不存在时不报错
+	}
+	if _, err := l.Stat(ctx, "ab/abc.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat after delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalCopy(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	put(t, l, "private/staging/abc.txt", "hello")
+
+	if err := l.Copy(ctx, "private/staging/abc.txt", "ab/abc.txt"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if got := read(t, l, "ab/abc.txt"); got != "hello" {
+		t.Fatalf("copied content = %q, want %q", got, "hello")
+	}
+	info, err := l.Stat(ctx, "ab/abc.txt")
+	if err != nil || info.ContentType != "text/plain" {
+		t.Fatalf("copied Stat = %+v, %v, want content type text/plain", info, err)
+	}
+	if got := read(t, l, "private/staging/abc.txt"); got != "hello" {
+		t.Fatalf("source changed after Copy: %q", got)
+	}
+
+	if err := l.Copy(ctx, "private/staging/missing.txt", "ab/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Copy missing err = %v, want ErrNotFound", err)
+	}
+	if err := l.Copy(ctx, "private/staging/abc.txt", "../escaped.txt"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Copy to invalid key err = %v, want ErrInvalidKey", err)
+	}
+}
+
+// presignedQuery 取出预签名地址里的 expires 和 signature
+func presignedQuery(t *testing.T, raw string) (string, string) {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %s: %v", raw, err)
+	}
+	return u.Query().Get("expires"), u.Query().Get("signature")
+}
+
+func TestLocalVerifyGet(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	raw, err := l.PresignGet(ctx, "ab/abc.png", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGet: %v", err)
+	}
+	if !strings.HasPrefix(raw, "http://localhost:8080/uploads/ab/abc.png?") {
+		t.Fatalf("PresignGet url = %s", raw)
+	}
+	expires, signature := presignedQuery(t, raw)
+
+	expired, err := l.PresignGet(ctx, "ab/abc.png", -time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGet expired: %v", err)
+	}
+	oldExpires, oldSignature := presignedQuery(t, expired)
+
+	other := newTestLocal(t)
+	other.secret = []byte("other-secret")
+	otherRaw, _ := other.PresignGet(ctx, "ab/abc.png", time.Minute)
+	otherExpires, otherSignature := presignedQuery(t, otherRaw)
+
+	tests := []struct {
+		name      string
+		key       string
+		expires   string
+		signature string
+		wantErr   error
+	}{
+		{"valid", "ab/abc.png", expires, signature, nil},
+		{"other key", "ab/other.png", expires, signature, ErrInvalidSignature},
+		{"extended expiry", "ab/abc.png", "9999999999", signature, ErrInvalidSignature},
+		{"expired", "ab/abc.png", oldExpires, oldSignature, ErrInvalidSignature},
+		{"bad expires", "ab/abc.png", "tomorrow", signature, ErrInvalidSignature},
+		{"empty signature", "ab/abc.png", expires, "", ErrInvalidSignature},
+		{"other secret", "ab/abc.png", otherExpires, otherSignature, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := l.VerifyGet(tt.key, tt.expires, tt.signature); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyGet err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalVerifyPut(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	req, err := l.PresignPut(ctx, "private/staging/abc.png", "image/png", 1024, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignPut: %v", err)
+	}
+	if req.Headers["Content-Type"] != "image/png" || req.Headers["Content-Length"] != "1024" {
+		t.Fatalf("PresignPut headers = %v", req.Headers)
+	}
+	expires, signature := presignedQuery(t, req.URL)
+
+	expired, err := l.PresignPut(ctx, "private/staging/abc.png", "image/png", 1024, -time.Minute)
+	if err != nil {
+		t.Fatalf("PresignPut expired: %v", err)
+	}
+	oldExpires, oldSignature := presignedQuery(t, expired.URL)
+
+	get, _ := l.PresignGet(ctx, "private/staging/abc.png", time.Minute)
+	getExpires, getSignature := presignedQuery(t, get)
+
+	tests := []struct {
+		name        string
+		key         string
+		contentType string
+		size        int64
+		expires     string
+		signature   string
+		wantErr     error
+	}{
+		{"valid", "private/staging/abc.png", "image/png", 1024, expires, signature, nil},
+		{"other type", "private/staging/abc.png", "text/html", 1024, expires, signature, ErrInvalidSignature},
+		{"larger body", "private/staging/abc.png", "image/png", 1 << 30, expires, signature, ErrInvalidSignature},
+		{"other key", "ab/abc.png", "image/png", 1024, expires, signature, ErrInvalidSignature},
+		{"expired", "private/staging/abc.png", "image/png", 1024, oldExpires, oldSignature, ErrInvalidSignature},
+		{"download signature", "private/staging/abc.png", "image/png", 1024, getExpires, getSignature, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := l.VerifyPut(tt.key, tt.contentType, tt.size, tt.expires, tt.signature); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyPut err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalDeleteExpired(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	put(t, l, "private/staging/old.txt", "old")
+	put(t, l, "private/staging/nested/old.txt", "old")
+	put(t, l, "private/staging/new.txt", "new")
+	put(t, l, "ab/old.txt", "old") // 不在前缀下
+	for _, key := range []string{"private/staging/old.txt", "private/staging/nested/old.txt", "ab/old.txt"} {
+		old := now.Add(-2 * time.Hour)
+		if err := os.Chtimes(l.objectPath(key), old, old); err != nil {
+			t.Fatalf("Chtimes %s: %v", key, err)
+		}
+	}
+	// 正在写入的临时文件以 . 开头，不能被删掉
+	tmp := filepath.Join(l.dir, "private", "staging", ".upload-123")
+	if err := os.WriteFile(tmp, []byte("partial"), 0o644); err != nil {
+		t.Fatalf("write tmp: %v", err)
+	}
+	old := now.Add(-2 * time.Hour)
+	os.Chtimes(tmp, old, old)
+
+	n, err := l.DeleteExpired(ctx, "private/staging/", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteExpired: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("DeleteExpired deleted %d, want 2", n)
+	}
+	for key, want := range map[string]error{
+		"private/staging/old.txt":        ErrNotFound,
+		"private/staging/nested/old.txt": ErrNotFound,
+		"private/staging/new.txt":        nil,
+		"ab/old.txt":                     nil,
+	} {
+		if _, err := l.Stat(ctx, key); !errors.Is(err, want) {
+			t.Errorf("Stat %s err = %v, want %v", key, err, want)
+		}
+	}
+	if _, err := os.Stat(l.metaPath("private/staging/old.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("meta of deleted object still exists: %v", err)
+	}
+	if _, err := os.Stat(tmp); err != nil {
+		t.Errorf("temp upload file deleted: %v", err)
+	}
+
+	// 还没写过的前缀不报错
+	if n, err := l.DeleteExpired(ctx, "private/never/", now); err != nil || n != 0 {
+		t.Fatalf("DeleteExpired empty prefix = %d, %v, want 0, nil", n, err)
+	}
+}
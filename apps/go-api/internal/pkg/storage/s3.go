@@ -2,9 +2,11 @@ package storage
 
 import (
 	"context"
-	"fmt"
-	"mime/multipart"
-	"path/filepath"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
 
 	"go-api/internal/config"
 
@@ -12,19 +14,47 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/google/uuid"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
-type S3Service struct {
-	client *s3.Client
-	bucket string
+// S3Backend S3 / MinIO 实现
+type S3Backend struct {
+	client  *s3.Client
+	presign *s3.PresignClient
+	bucket  string
 }
 
-func NewS3Service(cfg config.AWSConfig) (*S3Service, error) {
+func NewS3Backend(cfg config.AWSConfig) (*S3Backend, error) {
+	client, err := newS3Client(cfg, cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// 预签名地址是给浏览器用的，Host 在签名里，必须直接用公网可访问的地址签名
+	publicEndpoint := cfg.PublicEndpoint
+	if publicEndpoint == "" {
+		publicEndpoint = cfg.Endpoint
+	}
+	publicClient, err := newS3Client(cfg, publicEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	presign := s3.NewPresignClient(publicClient, func(po *s3.PresignOptions) {
+		po.ClientOptions = append(po.ClientOptions, func(o *s3.Options) {
+			// 新版 SDK 默认会给 PutObject 加 CRC32 校验头，预签名时没有请求体，签出来的校验值是错的
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		})
+	})
+
+	return &S3Backend{client: client, presign: presign, bucket: cfg.Bucket}, nil
+}
+
+func newS3Client(cfg config.AWSConfig, endpoint string) (*s3.Client, error) {
 	// 1. 加载 AWS 配置，强制使用 Path Style (MinIO 必须)
 	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
 		return aws.Endpoint{
-			URL:           cfg.Endpoint,
+			URL:           endpoint,
 			SigningRegion: cfg.Region,
 		}, nil
 	})
@@ -38,32 +68,145 @@ func NewS3Service(cfg config.AWSConfig) (*S3Service, error) {
 		return nil, err
 	}
 
-	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
 		o.UsePathStyle = true // MinIO 关键设置
+	}), nil
+}
+
+func (s *S3Backend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+		// ACL:    types.ObjectCannedACLPublicRead, // 如果 Bucket 没设 Public 策略，这里需要加 ACL
+	}
+	if size >= 0 {
+		input.ContentLength = aws.Int64(size)
+	}
+	_, err := s.client.PutObject(ctx, input)
+	return err
+}
+
+func (s *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return nil, nil, mapS3Error(err)
+	}
+	return out.Body, &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
 
-	return &S3Service{client: client, bucket: cfg.Bucket}, nil
+func (s *S3Backend) Delete(ctx context.Context, key string) error {
+	// S3 删除不存在的对象也返回成功
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
 }
 
-func (s *S3Service) UploadFile(file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
-	// 2. 生成唯一文件名
-	ext := filepath.Ext(fileHeader.Filename)
-	newFileName := fmt.Sprintf("%s%s", uuid.New().String(), ext)
+// Copy 服务端复制，CopySource 是 URL 编码后的 bucket/key
+func (s *S3Backend) Copy(ctx context.Context, src, dst string) error {
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String((&url.URL{Path: s.bucket + "/" + src}).EscapedPath()),
+	})
+	return mapS3Error(err)
+}
 
-	// 3. 上传
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(newFileName),
-		Body:        file,
-		ContentType: aws.String(fileHeader.Header.Get("Content-Type")),
-		// ACL:    types.ObjectCannedACLPublicRead, // 如果 Bucket 没设 Public 策略，这里需要加 ACL
+func (s *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return nil, mapS3Error(err)
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Backend) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
 	if err != nil {
 		return "", err
 	}
+	return req.URL, nil
+}
 
-	// 4. 返回完整 URL (如果是本地开发，通常返回相对路径或完整路径)
-	// 注意：在 Docker 网络里，这里是 minio:9000，但浏览器需要 localhost:9001 或 nginx 转发的地址
-	// 这里简单返回文件名，让前端拼接，或者返回相对路径
-	return newFileName, nil
+// PresignPut Content-Type 和 Content-Length 会进入签名 (SignedHeaders)，客户端必须原样发送
+func (s *S3Backend) PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (*PresignedRequest, error) {
+	req, err := s.presign.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(req.SignedHeader))
+	for k := range req.SignedHeader {
+		if http.CanonicalHeaderKey(k) == "Host" {
+			continue // 浏览器会自己带上
+		}
+		headers[http.CanonicalHeaderKey(k)] = req.SignedHeader.Get(k)
+	}
+	return &PresignedRequest{Method: req.Method, URL: req.URL, Headers: headers}, nil
+}
+
+// DeleteExpired 按前缀分页列出对象，逐个删除过期的
+func (s *S3Backend) DeleteExpired(ctx context.Context, prefix string, before time.Time) (int, error) {
+	var n int
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return n, err
+		}
+		for _, obj := range page.Contents {
+			if !aws.ToTime(obj.LastModified).Before(before) {
+				continue
+			}
+			if err := s.Delete(ctx, aws.ToString(obj.Key)); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// mapS3Error 把 404 统一转换成 ErrNotFound
+// HeadObject 没有响应体，拿不到 NoSuchKey 错误码，只能看 HTTP 状态码
+func mapS3Error(err error) error {
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+		return ErrNotFound
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "NotFound") {
+		return ErrNotFound
+	}
+	return err
 }
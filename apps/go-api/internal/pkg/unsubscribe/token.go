@@ -0,0 +1,53 @@
+package unsubscribe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidToken 令牌格式错误或签名不对
+var ErrInvalidToken = errors.New("unsubscribe: invalid token")
+
+// Signer 生成和校验退订令牌
+// 令牌格式 userID.signature，签名是 HMAC-SHA256(secret, "unsubscribe:<userID>")
+// 不存状态、不过期：邮件可能几个月后才被点开，退订链接必须一直有效；
+// 令牌泄露最多只能让对应用户退订，所以不需要一次性
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+// Sign 生成用户的退订令牌
+func (s *Signer) Sign(userID uint) string {
+	id := strconv.FormatUint(uint64(userID), 10)
+	return id + "." + s.signature(id)
+}
+
+// Verify 校验令牌并返回用户 ID
+func (s *Signer) Verify(token string) (uint, error) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || userID == 0 {
+		return 0, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.signature(id))) {
+		return 0, ErrInvalidToken
+	}
+	return uint(userID), nil
+}
+
+func (s *Signer) signature(id string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("unsubscribe:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
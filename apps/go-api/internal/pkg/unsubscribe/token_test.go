@@ -0,0 +1,57 @@
+package unsubscribe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	s := NewSigner("secret")
+	valid := s.Sign(42)
+	_, sig, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantID  uint
+		wantErr error
+	}{
+		{"valid", valid, 42, nil},
+		{"empty", "", 0, ErrInvalidToken},
+		{"no signature", "42", 0, ErrInvalidToken},
+		{"empty signature", "42.", 0, ErrInvalidToken},
+		{"signature of another user", "43." + sig, 0, ErrInvalidToken},
+		{"tampered signature", valid[:len(valid)-1] + "x", 0, ErrInvalidToken},
+		{"signed by another secret", NewSigner("other").Sign(42), 0, ErrInvalidToken},
+		{"zero user", "0." + sig, 0, ErrInvalidToken},
+		{"negative user", "-42." + sig, 0, ErrInvalidToken},
+		{"non numeric user", "abc." + sig, 0, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := s.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify err = %v, want %v", err, tt.wantErr)
+			}
+			if id != tt.wantID {
+				t.Errorf("Verify id = %d, want %d", id, tt.wantID)
+			}
+		})
+	}
+}
+
+// 令牌不存状态：同一个用户每次签出来都一样，可以放进 URL
+func TestSignIsStableAndURLSafe(t *testing.T) {
+	s := NewSigner("secret")
+	a, b := s.Sign(7), s.Sign(7)
+	if a != b {
+		t.Fatalf("Sign is not deterministic: %q != %q", a, b)
+	}
+	if strings.ContainsAny(a, "+/=") {
+		t.Fatalf("token %q is not URL safe", a)
+	}
+	if a == s.Sign(8) {
+		t.Fatal("different users got the same token")
+	}
+}
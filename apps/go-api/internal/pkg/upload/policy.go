@@ -0,0 +1,147 @@
+package upload
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go-api/internal/config"
+)
+
+var (
+	ErrEmptyFile         = errors.New("upload: empty file")
+	ErrTooLarge          = errors.New("upload: file too large")
+	ErrTypeNotAllowed    = errors.New("upload: content type not allowed")
+	ErrExtensionMismatch = errors.New("upload: extension does not match content")
+)
+
+// extensions 每种类型允许的扩展名，第一个是规范扩展名 (生成 key 时使用)
+// 只有这里列出的类型才能出现在白名单里，嗅探不出来的类型 (比如 svg 会被识别成 text/xml) 一律不支持
+// 图片只允许标准库能解码、能重新编码去掉元数据的格式，webp 之类去不掉 EXIF 的不支持
+var extensions = map[string][]string{
+	"image/jpeg":      {".jpg", ".jpeg"},
+	"image/png":       {".png"},
+	"image/gif":       {".gif"},
+	"application/pdf": {".pdf"},
+}
+
+// sniffLen http.DetectContentType 最多看前 512 字节
+const sniffLen = 512
+
+// Policy 上传校验规则：类型白名单 + 按套餐区分的大小上限
+type Policy struct {
+	allowed    map[string]bool
+	maxSize    int64
+	maxSizePro int64
+	quota      Quota
+	quotaPro   Quota
+}
+
+// Result 校验通过的文件信息，ContentType 以服务端嗅探结果为准，不信任客户端的 Content-Type
+type Result struct {
+	ContentType string
+	Ext         string // 规范扩展名，如 .jpg
+}
+
+func NewPolicy(cfg config.UploadConfig) *Policy {
+	allowed := make(map[string]bool, len(cfg.AllowedTypes))
+	for _, t := range cfg.AllowedTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if _, ok := extensions[t]; ok {
+			allowed[t] = true
+		}
+	}
+	return &Policy{
+		allowed:    allowed,
+		maxSize:    cfg.MaxSize,
+		maxSizePro: cfg.MaxSizePro,
+		quota:      Quota{Bytes: cfg.QuotaBytes, Files: cfg.QuotaFiles},
+		quotaPro:   Quota{Bytes: cfg.QuotaBytesPro, Files: cfg.QuotaFilesPro},
+	}
+}
+
+// Quota 该套餐的存储配额
+func (p *Policy) Quota(isPro bool) Quota {
+	if isPro {
+		return p.quotaPro
+	}
+	return p.quota
+}
+
+// MaxSize 该套餐允许的单文件大小上限 (字节)
+func (p *Policy) MaxSize(isPro bool) int64 {
+	if isPro && p.maxSizePro > p.maxSize {
+		return p.maxSizePro
+	}
+	return p.maxSize
+}
+
+// Check 校验大小、嗅探真实类型，并确认扩展名和内容一致
+// 会读取 r 的开头，返回前 seek 回起点，调用方可以直接继续上传
+func (p *Policy) Check(r io.ReadSeeker, filename string, size int64, isPro bool) (*Result, error) {
+	if err := p.checkSize(size, isPro); err != nil {
+		return nil, err
+	}
+
+	contentType, err := Sniff(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return p.CheckDeclared(filename, contentType, size, isPro)
+}
+
+// CheckDeclared 只按客户端声明的类型和大小校验 (预签名直传时文件还没上传)
+// 上传完成后还要用 Sniff 确认实际内容和声明一致
+func (p *Policy) CheckDeclared(filename, contentType string, size int64, isPro bool) (*Result, error) {
+	if err := p.checkSize(size, isPro); err != nil {
+		return nil, err
+	}
+	if !p.allowed[contentType] {
+		return nil, ErrTypeNotAllowed
+	}
+
+	exts := extensions[contentType]
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !slices.Contains(exts, ext) {
+		return nil, ErrExtensionMismatch
+	}
+	return &Result{ContentType: contentType, Ext: exts[0]}, nil
+}
+
+func (p *Policy) checkSize(size int64, isPro bool) error {
+	if size <= 0 {
+		return ErrEmptyFile
+	}
+	if size > p.MaxSize(isPro) {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// Sniff 读取开头最多 512 字节判断文件类型
+func Sniff(r io.Reader) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if errors.Is(err, io.EOF) {
+		return "", ErrEmptyFile
+	}
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return DetectContentType(head[:n]), nil
+}
+
+// DetectContentType 嗅探文件类型，去掉 "; charset=..." 之类的参数
+func DetectContentType(head []byte) string {
+	t := http.DetectContentType(head)
+	if i := strings.IndexByte(t, ';'); i >= 0 {
+		t = t[:i]
+	}
+	return strings.TrimSpace(t)
+}
@@ -0,0 +1,162 @@
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"go-api/internal/config"
+)
+
+// 各类型文件的开头 (http.DetectContentType 认的魔数)
+var (
+	jpegHead = []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00")
+	pngHead  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	gifHead  = []byte("GIF89a\x01\x00\x01\x00")
+	pdfHead  = []byte("%PDF-1.7\n")
+	webpHead = []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00")
+	svgHead  = []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+	htmlHead = []byte("<!DOCTYPE html><html><script>alert(1)</script></html>")
+)
+
+func testPolicy() *Policy {
+	return NewPolicy(config.UploadConfig{
+		// image/svg+xml、image/webp 不在 extensions 里，写进白名单也不生效
+		AllowedTypes: []string{"image/jpeg", " IMAGE/PNG ", "application/pdf", "image/svg+xml", "image/webp"},
+		MaxSize:      1 << 20,
+		MaxSizePro:   10 << 20,
+	})
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+		wantErr error
+	}{
+		{"jpeg", jpegHead, "image/jpeg", nil},
+		{"png", pngHead, "image/png", nil},
+		{"gif", gifHead, "image/gif", nil},
+		{"pdf", pdfHead, "application/pdf", nil},
+		{"webp", webpHead, "image/webp", nil},
+		{"svg is xml", svgHead, "text/xml", nil},
+		{"html without charset parameter", htmlHead, "text/html", nil},
+		{"longer than sniff window", append(pngHead, make([]byte, 4096)...), "image/png", nil},
+		{"empty", nil, "", ErrEmptyFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff(bytes.NewReader(tt.content))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Sniff err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Sniff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := testPolicy()
+
+	tests := []struct {
+		name     string
+		content  []byte
+		filename string
+		size     int64
+		isPro    bool
+		wantType string
+		wantExt  string
+		wantErr  error
+	}{
+		{"jpeg", jpegHead, "photo.JPEG", 100, false, "image/jpeg", ".jpg", nil},
+		{"png", pngHead, "a.png", 100, false, "image/png", ".png", nil},
+		{"pdf", pdfHead, "doc.pdf", 100, false, "application/pdf", ".pdf", nil},
+		{"png renamed to jpg", pngHead, "a.jpg", 100, false, "", "", ErrExtensionMismatch},
+		{"html renamed to png", htmlHead, "a.png", 100, false, "", "", ErrTypeNotAllowed},
+		{"svg allowed in config but not sniffable", svgHead, "a.svg", 100, false, "", "", ErrTypeNotAllowed},
+		{"webp cannot be stripped", webpHead, "a.webp", 100, false, "", "", ErrTypeNotAllowed},
+		{"gif not in allow list", gifHead, "a.gif", 100, false, "", "", ErrTypeNotAllowed},
+		{"no extension", pngHead, "png", 100, false, "", "", ErrExtensionMismatch},
+		{"empty", nil, "a.png", 0, false, "", "", ErrEmptyFile},
+		{"too large for free plan", pngHead, "a.png", 2 << 20, false, "", "", ErrTooLarge},
+		{"large file on pro plan", pngHead, "a.png", 2 << 20, true, "image/png", ".png", nil},
+		{"too large for pro plan", pngHead, "a.png", 11 << 20, true, "", "", ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.content)
+			res, err := p.Check(r, tt.filename, tt.size, tt.isPro)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if res.ContentType != tt.wantType || res.Ext != tt.wantExt {
+				t.Errorf("Check = %+v, want {%s %s}", *res, tt.wantType, tt.wantExt)
+			}
+			// 校验完要 seek 回起点，调用方直接上传完整内容
+			rest, _ := io.ReadAll(r)
+			if !bytes.Equal(rest, tt.content) {
+				t.Error("Check did not rewind the reader")
+			}
+		})
+	}
+}
+
+func TestCheckDeclared(t *testing.T) {
+	p := testPolicy()
+
+	tests := []struct {
+		name        string
+		filename    string
+		contentType string
+		size        int64
+		wantErr     error
+	}{
+		{"declared jpeg", "a.jpg", "image/jpeg", 100, nil},
+		{"declared type not allowed", "a.html", "text/html", 100, ErrTypeNotAllowed},
+		{"declared type with wrong extension", "a.pdf", "image/jpeg", 100, ErrExtensionMismatch},
+		{"declared type is case sensitive", "a.png", "IMAGE/PNG", 100, ErrTypeNotAllowed},
+		{"declared size too large", "a.png", "image/png", 2 << 20, ErrTooLarge},
+		{"declared size zero", "a.png", "image/png", 0, ErrEmptyFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.CheckDeclared(tt.filename, tt.contentType, tt.size, false); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckDeclared err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.UploadConfig
+		isPro  bool
+		expect int64
+	}{
+		{"free plan", config.UploadConfig{MaxSize: 10, MaxSizePro: 100}, false, 10},
+		{"pro plan", config.UploadConfig{MaxSize: 10, MaxSizePro: 100}, true, 100},
+		{"pro limit lower than free", config.UploadConfig{MaxSize: 10, MaxSizePro: 5}, true, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPolicy(tt.cfg).MaxSize(tt.isPro); got != tt.expect {
+				t.Errorf("MaxSize = %d, want %d", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestDetectContentTypeStripsParameters(t *testing.T) {
+	if got := DetectContentType([]byte("plain text")); strings.Contains(got, ";") {
+		t.Fatalf("DetectContentType = %q, want no parameters", got)
+	}
+}
@@ -0,0 +1,29 @@
+package upload
+
+import "errors"
+
+// ErrQuotaExceeded 加上这个文件后会超过用户的存储配额
+var ErrQuotaExceeded = errors.New("upload: storage quota exceeded")
+
+// Usage 用户已用的存储 (按原文件计算，缩略图不算；未完成的直传按声明的大小预占)
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// Quota 存储配额，<= 0 表示不限制
+type Quota struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// Allow 在已用 u 的基础上再上传一个 size 字节的文件是否超出配额
+func (q Quota) Allow(u Usage, size int64) error {
+	if q.Bytes > 0 && u.Bytes+size > q.Bytes {
+		return ErrQuotaExceeded
+	}
+	if q.Files > 0 && u.Files+1 > q.Files {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
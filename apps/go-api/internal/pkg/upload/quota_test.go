@@ -0,0 +1,35 @@
+package upload
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuotaAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		quota   Quota
+		usage   Usage
+		size    int64
+		wantErr error
+	}{
+		{"unlimited", Quota{}, Usage{Bytes: 1 << 40, Files: 1 << 20}, 1 << 30, nil},
+		{"negative means unlimited", Quota{Bytes: -1, Files: -1}, Usage{Bytes: 100, Files: 100}, 100, nil},
+		{"within both limits", Quota{Bytes: 1000, Files: 10}, Usage{Bytes: 500, Files: 5}, 400, nil},
+		{"exactly fills bytes", Quota{Bytes: 1000}, Usage{Bytes: 600}, 400, nil},
+		{"one byte over", Quota{Bytes: 1000}, Usage{Bytes: 600}, 401, ErrQuotaExceeded},
+		{"already over bytes", Quota{Bytes: 1000}, Usage{Bytes: 1200}, 1, ErrQuotaExceeded},
+		{"last file slot", Quota{Files: 10}, Usage{Files: 9}, 1, nil},
+		{"no file slot left", Quota{Files: 10}, Usage{Files: 10}, 1, ErrQuotaExceeded},
+		{"files limit only ignores bytes", Quota{Files: 10}, Usage{Bytes: 1 << 40}, 1 << 30, nil},
+		{"bytes limit only ignores files", Quota{Bytes: 1000}, Usage{Files: 1 << 20}, 10, nil},
+		{"bytes ok but files full", Quota{Bytes: 1000, Files: 3}, Usage{Bytes: 10, Files: 3}, 10, ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.quota.Allow(tt.usage, tt.size); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Allow err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
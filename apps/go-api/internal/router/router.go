@@ -2,8 +2,10 @@ package router
 
 import (
 	"go-api/internal/handlers"
+	"go-api/internal/models"
 	"go-api/internal/pkg/apperr"
 	"go-api/internal/pkg/response"
+	"go-api/internal/pkg/storage"
 	"go-api/internal/svc"
 	"log/slog"
 	"net/http"
@@ -30,7 +32,7 @@ func SetupRouter(ctx *svc.ServiceContext) *gin.Engine {
 	// 1. CORS 配置 (对齐 NestJS 的允许范围)
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
 	r.Use(cors.New(config))
 
@@ -38,16 +40,34 @@ func SetupRouter(ctx *svc.ServiceContext) *gin.Engine {
 	// Prometheus 会定时来这里“扒”数据
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	// 健康检查 (DB / Redis / MQ)，给 k8s 探针和负载均衡用
+	r.GET("/healthz", handlers.NewHealthHandler(ctx).Check)
+
 	// 2. 初始化处理器
 	postHandler := handlers.NewPostHandler(ctx)
 	authHandler := handlers.NewAuthHandler(ctx)
 	paymentHandler := handlers.NewPaymentHandler(ctx)
+	commentHandler := handlers.NewCommentHandler(ctx)
+	adminHandler := handlers.NewAdminHandler(ctx)
+	subscriptionHandler := handlers.NewSubscriptionHandler(ctx)
+	unsubscribeHandler := handlers.NewUnsubscribeHandler(ctx)
+	uploadHandler := handlers.NewUploadHandler(ctx)
+	attachmentHandler := handlers.NewAttachmentHandler(ctx)
+
+	// 需要登录的路由统一使用这个中间件 (带吊销检查)
+	jwtAuth := middleware.JWTAuth(ctx.Config.JWTSecret, ctx.Sessions)
 
 	// 认证路由
 	auth := r.Group("/auth")
 	{
 		auth.POST("/register", authHandler.Register)
 		auth.POST("/login", authHandler.Login)
+		auth.POST("/refresh", authHandler.Refresh)
+		auth.POST("/logout", jwtAuth, authHandler.Logout)
+		auth.GET("/verify", authHandler.VerifyEmail)
+		auth.POST("/verify/resend", jwtAuth, authHandler.ResendVerification)
+		auth.POST("/forgot-password", authHandler.ForgotPassword)
+		auth.POST("/reset-password", authHandler.ResetPassword)
 	}
 
 	// 3. 路由定义：保持与 NestJS 路径 100% 一致
@@ -55,9 +75,63 @@ func SetupRouter(ctx *svc.ServiceContext) *gin.Engine {
 	r.GET("/posts", postHandler.GetPosts)
 	r.GET("/posts/:id", postHandler.GetPostDetail)
 	// r.POST("/posts", postHandler.CreatePost)
-	r.POST("/posts", middleware.JWTAuth(ctx.Config.JWTSecret), postHandler.CreatePost)
+	r.POST("/posts", jwtAuth, postHandler.CreatePost)
+	r.PUT("/posts/:id", jwtAuth, postHandler.UpdatePost)
+	r.PATCH("/posts/:id", jwtAuth, postHandler.UpdatePost)
+	r.DELETE("/posts/:id", jwtAuth, postHandler.DeletePost)
+
+	// 评论 (楼中楼)
+	r.GET("/posts/:id/comments", commentHandler.ListComments)
+	r.POST("/posts/:id/comments", jwtAuth, commentHandler.CreateComment)
+	r.PUT("/posts/:id/comments/:commentId", jwtAuth, commentHandler.UpdateComment)
+	r.PATCH("/posts/:id/comments/:commentId", jwtAuth, commentHandler.UpdateComment)
+	r.DELETE("/posts/:id/comments/:commentId", jwtAuth, commentHandler.DeleteComment)
+
+	// 关注作者 / 订阅论坛，以及邮件通知偏好
+	r.POST("/users/:id/follow", jwtAuth, subscriptionHandler.FollowAuthor)
+	r.DELETE("/users/:id/follow", jwtAuth, subscriptionHandler.UnfollowAuthor)
+	subscriptions := r.Group("/subscriptions", jwtAuth)
+	{
+		subscriptions.GET("", subscriptionHandler.ListSubscriptions)
+		subscriptions.POST("/forum", subscriptionHandler.SubscribeForum)
+		subscriptions.DELETE("/forum", subscriptionHandler.UnsubscribeForum)
+	}
+	r.GET("/notification-settings", jwtAuth, subscriptionHandler.GetNotificationSettings)
+	r.PUT("/notification-settings", jwtAuth, subscriptionHandler.UpdateNotificationSettings)
+
+	// 邮件里的退订链接 (公开接口，令牌带签名)；POST 同时支持 RFC 8058 一键退订
+	r.GET("/unsubscribe", unsubscribeHandler.Confirm)
+	r.POST("/unsubscribe", unsubscribeHandler.Unsubscribe)
 
-	r.POST("/upload", middleware.JWTAuth(ctx.Config.JWTSecret), handlers.Upload)
+	r.POST("/upload", jwtAuth, uploadHandler.Upload)
+	r.POST("/upload/presign", jwtAuth, uploadHandler.Presign)
+	r.POST("/upload/complete", jwtAuth, uploadHandler.Complete)
+	attachments := r.Group("/attachments", jwtAuth)
+	{
+		attachments.GET("", attachmentHandler.ListAttachments)
+		attachments.GET("/usage", attachmentHandler.GetUsage)
+		attachments.GET("/:id", attachmentHandler.GetAttachment)
+		attachments.DELETE("/:id", attachmentHandler.DeleteAttachment)
+	}
+	// 本地磁盘存储时没有 MinIO，由 API 直接提供上传的文件和接收直传
+	if ctx.Config.Storage.Driver == storage.DriverLocal {
+		r.GET("/uploads/*key", uploadHandler.ServeLocalFile)
+		r.PUT("/uploads/*key", uploadHandler.ReceiveLocalUpload)
+	}
+
+	// 管理后台：版主管理帖子，管理员管理用户
+	admin := r.Group("/admin", jwtAuth)
+	{
+		admin.DELETE("/posts/:id", middleware.RequirePermission(middleware.PermPostModerate), adminHandler.DeletePost)
+		admin.POST("/posts/:id/restore", middleware.RequirePermission(middleware.PermPostModerate), adminHandler.RestorePost)
+		admin.PUT("/users/:id/role", middleware.RequirePermission(middleware.PermUserManage), adminHandler.UpdateUserRole)
+		admin.GET("/dead-letters", middleware.RequireRole(models.RoleAdmin), adminHandler.ListDeadLetters)
+		admin.POST("/dead-letters/:id/replay", middleware.RequireRole(models.RoleAdmin), adminHandler.ReplayDeadLetter)
+		admin.GET("/outbox", middleware.RequireRole(models.RoleAdmin), adminHandler.ListOutboxEvents)
+		admin.POST("/outbox/:id/requeue", middleware.RequireRole(models.RoleAdmin), adminHandler.RequeueOutboxEvent)
+		admin.GET("/mail-templates", middleware.RequireRole(models.RoleAdmin), adminHandler.ListMailTemplates)
+		admin.GET("/mail-templates/:name/preview", middleware.RequireRole(models.RoleAdmin), adminHandler.PreviewMailTemplate)
+	}
 
 	// 支付模块
 	payment := r.Group("/payment")
@@ -67,7 +141,7 @@ func SetupRouter(ctx *svc.ServiceContext) *gin.Engine {
 		payment.POST("/webhook", paymentHandler.HandleWebhook)
 
 		// 创建支付链接需要登录
-		payment.POST("/checkout", middleware.JWTAuth(ctx.Config.JWTSecret), paymentHandler.CreateCheckoutSession)
+		payment.POST("/checkout", jwtAuth, paymentHandler.CreateCheckoutSession)
 	}
 
 	return r
@@ -2,6 +2,10 @@ package svc
 
 import (
 	"go-api/internal/config"
+	"go-api/internal/pkg/cache"
+	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/session"
+	"go-api/internal/pkg/storage"
 
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -9,16 +13,24 @@ import (
 
 // ServiceContext 是一个容器，持有所有全局依赖
 type ServiceContext struct {
-	Config *config.Config
-	DB     *gorm.DB
-	Redis  *redis.Client
+	Config   *config.Config
+	DB       *gorm.DB
+	Redis    *redis.Client
+	Cache    *cache.Cache    // 基于 Redis 的 Cache-Aside 封装
+	Sessions *session.Store  // 登录 session 与 refresh token
+	MQ       mq.Broker       // 消息队列 (RabbitMQ 或进程内实现，由配置决定)
+	Storage  storage.Backend // 对象存储 (S3/MinIO 或本地磁盘，由配置决定)
 }
 
 // NewServiceContext 工厂函数
-func NewServiceContext(c *config.Config, db *gorm.DB, rdb *redis.Client) *ServiceContext {
+func NewServiceContext(c *config.Config, db *gorm.DB, rdb *redis.Client, broker mq.Broker, store storage.Backend) *ServiceContext {
 	return &ServiceContext{
-		Config: c,
-		DB:     db,
-		Redis:  rdb,
+		Config:   c,
+		DB:       db,
+		Redis:    rdb,
+		Cache:    cache.New(rdb),
+		Sessions: session.NewStore(rdb, c.Auth.AccessTokenTTL, c.Auth.RefreshTokenTTL, c.Auth.NestTokenTTL),
+		MQ:       broker,
+		Storage:  store,
 	}
 }
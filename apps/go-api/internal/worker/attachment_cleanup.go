@@ -0,0 +1,192 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-api/internal/config"
+	"go-api/internal/models"
+	"go-api/internal/pkg/blob"
+	"go-api/internal/pkg/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AttachmentCleanupJob 定时清理存储
+//  1. 孤儿附件：超过宽限期仍没有关联到任何帖子的上传 (包括没有完成的直传)，删除记录并释放对 Blob 的引用；
+//     直传的临时对象在事务提交后再删，删不掉的记录保留为 deleting，下一轮再试
+//  2. 过期的暂存对象：直传地址在登记后仍然有效，客户端还能再写进来；删除暂存对象失败时也会留下
+//  3. 上传中断、一直停在 storing 的 Blob 标记为 failed
+//  4. 没有引用的 Blob：引用减到 0 超过宽限期后标记为 deleting 并提交，再删存储里的对象和记录；删对象失败的保留记录，下一轮再试
+type AttachmentCleanupJob struct {
+	db    *gorm.DB
+	store storage.Backend
+	cfg   config.UploadConfig
+}
+
+func NewAttachmentCleanupJob(db *gorm.DB, store storage.Backend, cfg config.UploadConfig) *AttachmentCleanupJob {
+	return &AttachmentCleanupJob{db: db, store: store, cfg: cfg}
+}
+
+// Start 在后台运行，ctx 取消后退出
+func (j *AttachmentCleanupJob) Start(ctx context.Context) {
+	go func() {
+		log.Printf("🧹 [Cleanup] 已启动，检查间隔 %s，宽限期 %s", j.cfg.CleanupInterval, j.cfg.OrphanGrace)
+
+		ticker := time.NewTicker(j.cfg.CleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("🧹 [Cleanup] 已停止")
+				return
+			case <-ticker.C:
+			}
+
+			// 这一轮只处理 tick 时已经过期的附件和对象；删除失败的会被跳过，不会在这里死循环
+			cutoff := time.Now().Add(-j.cfg.OrphanGrace)
+			var afterID uint
+			for {
+				n, lastID, err := j.runBatch(ctx, cutoff, afterID)
+				if err != nil {
+					log.Printf("❌ [Cleanup] 清理附件失败: %v", err)
+					break
+				}
+				if n < j.cfg.CleanupBatchSize {
+					break
+				}
+				afterID = lastID
+			}
+
+			j.expireStaging(ctx, cutoff)
+			j.failStaleStoring(ctx, cutoff)
+
+			var afterKey string
+			for {
+				n, lastKey, err := j.sweepBlobs(ctx, cutoff, afterKey)
+				if err != nil {
+					log.Printf("❌ [Cleanup] 清理对象失败: %v", err)
+					break
+				}
+				if n < j.cfg.CleanupBatchSize {
+					break
+				}
+				afterKey = lastKey
+			}
+		}
+	}()
+}
+
+// runBatch 取一批过期的孤儿附件删除，返回本批数量和最后一个 ID
+// FOR UPDATE SKIP LOCKED：多实例时不会重复删除，正在被发帖关联的附件也会被跳过
+// 事务里只改数据库 (删记录、释放引用、标记直传为 deleting)，提交后再删存储里的临时对象
+func (j *AttachmentCleanupJob) runBatch(ctx context.Context, cutoff time.Time, afterID uint) (int, uint, error) {
+	var count int
+	var lastID uint
+	var staging []models.Attachment
+	err := j.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orphans []models.Attachment
+		if err := tx.Where(`"postId" IS NULL AND ("updatedAt" < ? OR status = ?) AND id > ?`, cutoff, models.AttachmentDeleting, afterID).
+			Order("id").
+			Limit(j.cfg.CleanupBatchSize).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Find(&orphans).Error; err != nil {
+			return err
+		}
+		count = len(orphans)
+		if count == 0 {
+			return nil
+		}
+		lastID = orphans[count-1].ID
+
+		var err error
+		if staging, err = blob.RemoveAttachments(tx, orphans); err != nil {
+			return err
+		}
+		log.Printf("🧹 [Cleanup] 已删除孤儿附件: %d 个", count)
+		return nil
+	})
+	if err != nil {
+		return count, lastID, err
+	}
+
+	// 删不掉的临时对象保留 deleting 记录，下一轮再试，不影响这一轮继续往后处理
+	if err := blob.PurgeStaging(ctx, j.db, j.store, staging); err != nil {
+		log.Printf("❌ [Cleanup] 删除临时对象失败: %v", err)
+	}
+	return count, lastID, nil
+}
+
+// expireStaging 删除超过宽限期的暂存对象
+// 暂存对象不会早于引用它的直传附件创建，能删的对象对应的附件在这之前已经作为孤儿被删掉了
+func (j *AttachmentCleanupJob) expireStaging(ctx context.Context, cutoff time.Time) {
+	n, err := j.store.DeleteExpired(ctx, blob.StagingPrefix, cutoff)
+	if err != nil {
+		log.Printf("❌ [Cleanup] 清理暂存对象失败: %v", err)
+	}
+	if n > 0 {
+		log.Printf("🧹 [Cleanup] 已删除过期的暂存对象: %d 个", n)
+	}
+}
+
+// failStaleStoring 上传在复制对象时进程退出，Blob 会一直停在 storing，超过宽限期的标记为 failed
+func (j *AttachmentCleanupJob) failStaleStoring(ctx context.Context, cutoff time.Time) {
+	res := j.db.WithContext(ctx).Model(&models.Blob{}).
+		Where(`status = ? AND "updatedAt" < ?`, models.BlobStoring, cutoff).
+		Updates(map[string]interface{}{"status": models.BlobFailed, "processError": "upload interrupted"})
+	if res.Error != nil {
+		log.Printf("❌ [Cleanup] 处理中断的上传失败: %v", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("🧹 [Cleanup] 已标记中断的上传: %d 个", res.RowsAffected)
+	}
+}
+
+// sweepBlobs 取一批引用为 0 且过了宽限期的 Blob (以及上一轮没删完的)，删除对象和记录，返回本批数量和最后一个 key
+// 事务里只标记为 deleting，提交后再访问存储：标记之后 Acquire 不会再引用它，同样内容的上传等记录删掉后按新对象写入
+// 删对象失败的保留 deleting 记录，下一轮再试
+func (j *AttachmentCleanupJob) sweepBlobs(ctx context.Context, cutoff time.Time, afterKey string) (int, string, error) {
+	var blobs []models.Blob
+	err := j.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(`(("refCount" = 0 AND "updatedAt" < ?) OR status = ?) AND key > ?`, cutoff, models.BlobDeleting, afterKey).
+			Order("key").
+			Limit(j.cfg.CleanupBatchSize).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Find(&blobs).Error; err != nil {
+			return err
+		}
+		if len(blobs) == 0 {
+			return nil
+		}
+
+		keys := make([]string, 0, len(blobs))
+		for _, b := range blobs {
+			keys = append(keys, b.Key)
+		}
+		return tx.Model(&models.Blob{}).Where("key IN ?", keys).UpdateColumn("status", models.BlobDeleting).Error
+	})
+	if err != nil || len(blobs) == 0 {
+		return 0, "", err
+	}
+
+	var deleted int
+	for _, b := range blobs {
+		if err := storage.DeleteAll(ctx, j.store, b.ObjectKeys()); err != nil {
+			log.Printf("❌ [Cleanup] 删除对象失败: Key=%s, err=%v", b.Key, err)
+			continue
+		}
+		if err := j.db.WithContext(ctx).Where("key = ? AND status = ?", b.Key, models.BlobDeleting).Delete(&models.Blob{}).Error; err != nil {
+			log.Printf("❌ [Cleanup] 删除对象记录失败: Key=%s, err=%v", b.Key, err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Printf("🧹 [Cleanup] 已删除没有引用的对象: %d 个", deleted)
+	}
+	return len(blobs), blobs[len(blobs)-1].Key, nil
+}
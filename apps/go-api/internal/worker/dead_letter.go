@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"encoding/json"
+	"log"
+
+	"go-api/internal/models"
+	"go-api/internal/pkg/mq"
+
+	"gorm.io/gorm"
+)
+
+// SaveDeadLetter 把死信落库，供管理后台查看和重放
+func SaveDeadLetter(db *gorm.DB) mq.DeadLetterHandler {
+	return func(dl mq.DeadLetter) error {
+		// 尽量解析出 pattern 方便筛选，解析不了也照样保存原始消息
+		var envelope struct {
+			Pattern string `json:"pattern"`
+		}
+		json.Unmarshal(dl.Body, &envelope)
+
+		log.Printf("☠️ [Go Worker] 收到死信: Pattern=%s, Attempts=%d, Err=%s", envelope.Pattern, dl.Attempts, dl.Error)
+
+		return db.Create(&models.DeadLetter{
+			Pattern:  envelope.Pattern,
+			Body:     string(dl.Body),
+			Error:    dl.Error,
+			Attempts: dl.Attempts,
+		}).Error
+	}
+}
@@ -0,0 +1,211 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go-api/internal/config"
+	"go-api/internal/mailer"
+	"go-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DigestJob 定时给选择了每日/每周摘要的用户发新帖摘要
+// 每个用户的投递状态记在 DigestState 表里：成功后推进 LastSentAt，失败按 Failures 指数退避，到期再试
+type DigestJob struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	mailer *mailer.Mailer
+}
+
+func NewDigestJob(db *gorm.DB, cfg *config.Config, m *mailer.Mailer) *DigestJob {
+	return &DigestJob{db: db, cfg: cfg, mailer: m}
+}
+
+// digestCandidate 到期需要发摘要的用户
+type digestCandidate struct {
+	UserID     uint
+	Email      string
+	Locale     string
+	Frequency  string
+	LastSentAt *time.Time
+	Failures   int
+}
+
+// Start 在后台运行，ctx 取消后退出
+func (j *DigestJob) Start(ctx context.Context) {
+	go func() {
+		log.Printf("📰 [Digest] 已启动，检查间隔 %s", j.cfg.Digest.PollInterval)
+
+		ticker := time.NewTicker(j.cfg.Digest.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("📰 [Digest] 已停止")
+				return
+			case <-ticker.C:
+			}
+
+			// 一批处理满了说明可能还有到期的用户，继续处理，不等下一个 tick
+			for {
+				n, err := j.runBatch(ctx, time.Now())
+				if err != nil {
+					log.Printf("❌ [Digest] 处理失败: %v", err)
+					break
+				}
+				if n < j.cfg.Digest.BatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// runBatch 领取一批到期的用户发摘要
+// 领取 (短事务) -> 提交 -> 发信 -> 按租约写回结果，发信期间不持有行锁
+// 领取时 nextAttemptAt 推到租约到期时间，失败后推到退避时间，所以本轮失败的用户不会被马上再领取
+// 发信成功但写回失败时，租约过期后会再发一次 (至少一次)
+func (j *DigestJob) runBatch(ctx context.Context, now time.Time) (int, error) {
+	candidates, leaseID, err := j.claim(ctx, now)
+	if err != nil || len(candidates) == 0 {
+		return 0, err
+	}
+
+	for _, u := range candidates {
+		total, sendErr := j.deliver(j.db.WithContext(ctx), u, now)
+		if err := j.db.WithContext(ctx).Model(&models.DigestState{}).
+			Where(`"userId" = ? AND "leaseId" = ?`, u.UserID, leaseID).
+			Updates(j.nextState(u, now, total, sendErr)).Error; err != nil {
+			return len(candidates), err
+		}
+	}
+	return len(candidates), nil
+}
+
+// claim 领取一批到期的用户：写入租约 ID，并把 nextAttemptAt 推到租约到期时间
+// FOR UPDATE SKIP LOCKED 锁住用户的通知设置，多实例部署时同一个用户不会被重复领取
+func (j *DigestJob) claim(ctx context.Context, now time.Time) ([]digestCandidate, string, error) {
+	leaseID := uuid.New().String()
+	var candidates []digestCandidate
+	err := j.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(`"NotificationSetting" ns`).
+			Select(`ns."userId" AS user_id, u.email, ns.locale, ns."newPostFrequency" AS frequency, ds."lastSentAt" AS last_sent_at, COALESCE(ds.failures, 0) AS failures`).
+			Joins(`JOIN "User" u ON u.id = ns."userId"`).
+			Joins(`LEFT JOIN "DigestState" ds ON ds."userId" = ns."userId"`).
+			Where(`ns."unsubscribedAt" IS NULL`).
+			Where(`ds."nextAttemptAt" IS NULL OR ds."nextAttemptAt" <= ?`, now).
+			Where(`NOT EXISTS (SELECT 1 FROM "EmailSuppression" es WHERE es.email = LOWER(u.email))`).
+			Where(`(ns."newPostFrequency" = ? AND (ds."lastSentAt" IS NULL OR ds."lastSentAt" <= ?)) OR (ns."newPostFrequency" = ? AND (ds."lastSentAt" IS NULL OR ds."lastSentAt" <= ?))`,
+				models.FrequencyDaily, now.Add(-digestPeriod(models.FrequencyDaily)),
+				models.FrequencyWeekly, now.Add(-digestPeriod(models.FrequencyWeekly))).
+			Order(`ns."userId"`).
+			Limit(j.cfg.Digest.BatchSize).
+			Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "ns"}, Options: "SKIP LOCKED"}).
+			Scan(&candidates).Error; err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		// 第一次发摘要的用户还没有 DigestState，一起建出来
+		leaseUntil := now.Add(j.cfg.Digest.Lease)
+		states := make([]models.DigestState, 0, len(candidates))
+		for _, u := range candidates {
+			states = append(states, models.DigestState{UserID: u.UserID, NextAttemptAt: &leaseUntil, LeaseID: leaseID})
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "userId"}},
+			DoUpdates: clause.AssignmentColumns([]string{"nextAttemptAt", "leaseId", "updatedAt"}),
+		}).Create(&states).Error
+	})
+	return candidates, leaseID, err
+}
+
+// deliver 收集 [since, now) 之间的新帖并发送摘要，返回新帖总数；没有新帖时不发信
+func (j *DigestJob) deliver(db *gorm.DB, u digestCandidate, now time.Time) (int, error) {
+	since := now.Add(-digestPeriod(u.Frequency))
+	if u.LastSentAt != nil {
+		since = *u.LastSentAt
+	}
+
+	query := db.Model(&models.Post{}).
+		Where(`"createdAt" >= ? AND "createdAt" < ? AND "authorId" <> ?`, since, now, u.UserID).
+		Where(`EXISTS (SELECT 1 FROM "Subscription" s WHERE s."userId" = ? AND (s."targetType" = ? OR (s."targetType" = ? AND s."targetId" = "Post"."authorId")))`,
+						u.UserID, models.SubscriptionTargetForum, models.SubscriptionTargetAuthor).
+		Session(&gorm.Session{}) // Count 和 Find 共用同一组条件
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	var posts []models.Post
+	if err := query.Select("id", "title", `"createdAt"`).
+		Order(`"createdAt" DESC`).Limit(j.cfg.Digest.MaxPosts).
+		Find(&posts).Error; err != nil {
+		return 0, err
+	}
+
+	data := mailer.DigestData{
+		Weekly:      u.Frequency == models.FrequencyWeekly,
+		Total:       int(total),
+		More:        int(total) - len(posts),
+		ForumURL:    j.cfg.App.FrontendURL,
+		SettingsURL: j.cfg.App.FrontendURL + "/settings/notifications",
+	}
+	for _, p := range posts {
+		data.Posts = append(data.Posts, mailer.DigestPost{
+			Title:     p.Title,
+			URL:       fmt.Sprintf("%s/posts/%d", j.cfg.App.FrontendURL, p.ID),
+			CreatedAt: p.CreatedAt.Format("2006-01-02 15:04"),
+		})
+	}
+
+	if err := j.mailer.SendDigest(u.UserID, u.Email, u.Locale, data); err != nil {
+		log.Printf("❌ [Digest] 摘要发送失败: UserID=%d, err=%v", u.UserID, err)
+		return int(total), err
+	}
+	log.Printf("✅ [Digest] 摘要发送成功: UserID=%d, 帖子=%d", u.UserID, total)
+	return int(total), nil
+}
+
+// nextState 根据发送结果计算用户的摘要状态
+// 失败时不推进 LastSentAt，退避到期后会把这段时间的帖子再收集一次
+func (j *DigestJob) nextState(u digestCandidate, now time.Time, total int, sendErr error) map[string]interface{} {
+	if sendErr != nil {
+		failures := u.Failures + 1
+		return map[string]interface{}{
+			"failures":      failures,
+			"lastError":     sendErr.Error(),
+			"nextAttemptAt": now.Add(backoff(failures, j.cfg.Digest.PollInterval, 6*time.Hour)),
+			"leaseId":       "",
+		}
+	}
+
+	return map[string]interface{}{
+		"lastSentAt":    now,
+		"lastPostCount": total,
+		"failures":      0,
+		"lastError":     "",
+		"nextAttemptAt": nil,
+		"leaseId":       "",
+	}
+}
+
+func digestPeriod(frequency string) time.Duration {
+	if frequency == models.FrequencyWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
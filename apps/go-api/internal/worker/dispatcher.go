@@ -0,0 +1,114 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-api/internal/pkg/mq"
+)
+
+// ErrUnknownPattern 没有注册处理函数的消息类型
+var ErrUnknownPattern = errors.New("worker: unknown message pattern")
+
+// Envelope NestJS Microservice 的消息格式 ({pattern, data})
+type Envelope[T any] struct {
+	Pattern string `json:"pattern"`
+	Data    T      `json:"data"`
+}
+
+// route 一个 pattern 对应的处理函数和并发槽位
+type route struct {
+	handle func(msg []byte) error
+	slots  chan struct{} // 带缓冲的 channel 当信号量用，容量就是并发上限
+}
+
+// Dispatcher 按消息的 pattern 字段分发给注册的处理函数
+// Handle 方法本身就是一个 mq.Handler，直接交给 broker.StartConsumer
+type Dispatcher struct {
+	routes map[string]*route
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		routes: make(map[string]*route),
+	}
+}
+
+// Register 注册 pattern 的处理函数，data 字段会被解析成 T 再传给 fn
+// concurrency 限制同一个 pattern 同时处理的消息数 (<= 0 表示不限制)
+// 超过上限的消息返回 mq.ErrBusy 交还给 MQ，稍后重新投递
+// Go 的方法不支持类型参数，所以写成普通函数
+func Register[T any](d *Dispatcher, pattern string, concurrency int, fn func(data T) error) {
+	if _, ok := d.routes[pattern]; ok {
+		panic(fmt.Sprintf("worker: pattern %q registered twice", pattern))
+	}
+
+	r := &route{
+		handle: func(msg []byte) error {
+			var env Envelope[T]
+			if err := json.Unmarshal(msg, &env); err != nil {
+				return mq.Permanent(fmt.Errorf("解析消息失败: %w", err)) // 格式错误，重试也没用
+			}
+			return fn(env.Data)
+		},
+	}
+	if concurrency > 0 {
+		r.slots = make(chan struct{}, concurrency)
+	}
+	d.routes[pattern] = r
+}
+
+// Handle 队列消费入口：按 pattern 找到处理函数并执行
+// 返回 error 时由 MQ 负责重试，重试耗尽后进入死信
+func (d *Dispatcher) Handle(msg []byte) error {
+	var envelope struct {
+		Pattern string `json:"pattern"`
+	}
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		log.Printf("❌ 解析消息失败: %v", err)
+		handledTotal.WithLabelValues(unknownPatternLabel, resultPermanent).Inc()
+		return mq.Permanent(fmt.Errorf("解析消息失败: %w", err))
+	}
+
+	r, ok := d.routes[envelope.Pattern]
+	if !ok {
+		// 直接进死信，部署了对应的处理函数后可以在管理后台重放
+		log.Printf("⚠️ [Go Worker] 未知的消息类型: %s", envelope.Pattern)
+		handledTotal.WithLabelValues(unknownPatternLabel, resultPermanent).Inc()
+		return mq.Permanent(fmt.Errorf("%w: %s", ErrUnknownPattern, envelope.Pattern))
+	}
+
+	if r.slots != nil {
+		select {
+		case r.slots <- struct{}{}:
+			defer func() { <-r.slots }()
+		default:
+			// 不在这里等槽位：等待中的消息占着 prefetch，会把其它 pattern 的消息也堵住
+			handledTotal.WithLabelValues(envelope.Pattern, resultBusy).Inc()
+			return mq.ErrBusy
+		}
+	}
+
+	inFlight.WithLabelValues(envelope.Pattern).Inc()
+	start := time.Now()
+	err := r.handle(msg)
+	handleDuration.WithLabelValues(envelope.Pattern).Observe(time.Since(start).Seconds())
+	inFlight.WithLabelValues(envelope.Pattern).Dec()
+
+	handledTotal.WithLabelValues(envelope.Pattern, resultOf(err)).Inc()
+	return err
+}
+
+func resultOf(err error) string {
+	switch {
+	case err == nil:
+		return resultSuccess
+	case mq.IsPermanent(err):
+		return resultPermanent
+	default:
+		return resultRetry
+	}
+}
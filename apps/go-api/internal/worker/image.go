@@ -0,0 +1,189 @@
+// apps/go-api/internal/worker/image.go
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"go-api/internal/config"
+	"go-api/internal/models"
+	"go-api/internal/pkg/imaging"
+	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/storage"
+
+	"gorm.io/gorm"
+)
+
+type ImageUploaded struct {
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+}
+
+// ImageProcessor 图片处理：去除元数据、按配置生成各尺寸缩略图
+// 按 Blob 处理，同样内容的附件共享处理结果；上传的原图在私有的 OriginalKey，去掉元数据的版本写到公开的 Key 后删除原图
+// 缩略图存在旁边：ab/abc.jpg -> ab/abc_thumb.jpg
+type ImageProcessor struct {
+	db    *gorm.DB
+	store storage.Backend
+	cfg   config.ImageConfig
+}
+
+func NewImageProcessor(db *gorm.DB, store storage.Backend, cfg config.ImageConfig) *ImageProcessor {
+	return &ImageProcessor{db: db, store: store, cfg: cfg}
+}
+
+// Register 把处理函数注册到 dispatcher 上
+// 解码和缩放都很吃 CPU 和内存，并发给低一点
+func (p *ImageProcessor) Register(d *Dispatcher) {
+	Register(d, mq.PatternImageUploaded, 2, p.Handle)
+}
+
+// Handle 处理一张上传的图片
+// 存储读写失败交给 MQ 重试；图片本身有问题 (解码失败、尺寸过大) 重试也没用，删掉原图并标记为 failed，不对外提供
+func (p *ImageProcessor) Handle(msg ImageUploaded) error {
+	log.Printf("📥 [Go Worker] 收到图片处理任务: Key=%s", msg.Key)
+
+	var b models.Blob
+	if err := p.db.Where("key = ?", msg.Key).First(&b).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("⚠️ [Go Worker] 对象已不存在，跳过: Key=%s", msg.Key)
+			return nil
+		}
+		return err
+	}
+	if b.Status != models.BlobPending {
+		return nil // 重复投递，已经处理过了
+	}
+
+	ctx := context.Background()
+	data, err := p.read(ctx, b.OriginalKey())
+	if errors.Is(err, storage.ErrNotFound) {
+		return p.fail(ctx, &b, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	img, err := imaging.Decode(data, p.cfg.MaxPixels)
+	if err != nil {
+		log.Printf("❌ [Go Worker] 图片解码失败: Key=%s, err=%v", b.Key, err)
+		return p.fail(ctx, &b, err)
+	}
+
+	// 1. 去除元数据：重新编码后写到公开的 key
+	stripped, err := p.strip(data, img)
+	if err != nil {
+		return p.fail(ctx, &b, err)
+	}
+	if err := p.store.Put(ctx, b.Key, bytes.NewReader(stripped), int64(len(stripped)), b.MimeType); err != nil {
+		return err
+	}
+
+	// 2. 生成各尺寸缩略图
+	variants := make(map[string]string, len(p.cfg.Variants))
+	format := imaging.VariantFormat(img.Format)
+	for _, v := range p.cfg.Variants {
+		resized := imaging.Resize(img.RGBA, v.MaxEdge)
+		if resized == nil {
+			variants[v.Name] = b.Key // 原图已经够小，不放大
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, resized, format, p.cfg.JPEGQuality); err != nil {
+			b.Variants = variants // 已经写出去的缩略图一起删掉
+			return p.fail(ctx, &b, err)
+		}
+		key := variantKey(b.Key, v.Name, format)
+		if err := p.store.Put(ctx, key, &buf, int64(buf.Len()), "image/"+format); err != nil {
+			return err
+		}
+		variants[v.Name] = key
+	}
+
+	// Checksum 是上传内容的哈希 (决定了 key)，去除元数据后不更新，只更新实际存储的大小
+	b.Size = int64(len(stripped))
+	b.Width = img.Width()
+	b.Height = img.Height()
+	b.Variants = variants
+	if err := p.finish(ctx, &b, models.BlobReady, nil); err != nil {
+		return err
+	}
+	// 原图带着元数据，处理完就删掉；删除失败只记日志，私有对象不会被访问到，Blob 被清理时会一起删
+	if err := p.store.Delete(ctx, b.OriginalKey()); err != nil {
+		log.Printf("⚠️ [Go Worker] 删除原图失败: Key=%s, err=%v", b.OriginalKey(), err)
+	}
+	log.Printf("✅ [Go Worker] 图片处理完成: Key=%s, 尺寸=%dx%d, 缩略图=%d", b.Key, b.Width, b.Height, len(variants))
+	return nil
+}
+
+func (p *ImageProcessor) read(ctx context.Context, key string) ([]byte, error) {
+	body, _, err := p.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// strip 返回去掉元数据后的原图
+// JPEG 用转正后的像素重新编码 (方向信息在 EXIF 里，去掉之后必须把像素本身转过来)；GIF 保留动画
+func (p *ImageProcessor) strip(data []byte, img *imaging.Image) ([]byte, error) {
+	if img.Format == imaging.FormatGIF {
+		return imaging.StripGIF(data)
+	}
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img.RGBA, img.Format, p.cfg.JPEGQuality); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fail 图片处理失败：删掉原图和可能已经写出去的文件，标记为 failed
+// 删除失败交给 MQ 重试，不能留下没去掉元数据的文件
+func (p *ImageProcessor) fail(ctx context.Context, b *models.Blob, cause error) error {
+	if err := storage.DeleteAll(ctx, p.store, b.ObjectKeys()); err != nil {
+		return err
+	}
+	return p.finish(ctx, b, models.BlobFailed, cause)
+}
+
+// finish 写入处理结果；只更新仍然是 pending 的记录，避免并发重复处理时互相覆盖
+// 处理期间记录被清理任务删掉 (或标记为 deleting) 时，清理任务可能已经删过对象，刚写出去的文件由这里删掉
+func (p *ImageProcessor) finish(ctx context.Context, b *models.Blob, status string, cause error) error {
+	b.Status = status
+	if cause != nil {
+		b.ProcessError = cause.Error()
+	}
+	res := p.db.Model(&models.Blob{}).
+		Where("key = ? AND status = ?", b.Key, models.BlobPending).
+		Select("status", "size", "width", "height", "variants", "processError").
+		Updates(b)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+
+	var cur models.Blob
+	err := p.db.Select("status").Where("key = ?", b.Key).First(&cur).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && cur.Status == models.BlobDeleting) {
+		log.Printf("⚠️ [Go Worker] 对象在处理期间被清理，删除处理结果: Key=%s", b.Key)
+		return storage.DeleteAll(ctx, p.store, b.ObjectKeys())
+	}
+	return err // 被并发的重复处理抢先完成，写出去的内容相同，保留
+}
+
+// variantKey abc.jpg + thumb -> abc_thumb.jpg (GIF 的缩略图是 PNG)
+func variantKey(key, name, format string) string {
+	ext := ".png"
+	if format == imaging.FormatJPEG {
+		ext = ".jpg"
+	}
+	return fmt.Sprintf("%s_%s%s", strings.TrimSuffix(key, path.Ext(key)), name, ext)
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 处理结果 (result 标签)
+const (
+	resultSuccess   = "success"
+	resultRetry     = "retry"     // 失败，交给 MQ 重试
+	resultPermanent = "permanent" // 失败且不可重试，直接进死信
+	resultBusy      = "busy"      // 并发槽位已满，稍后重新投递
+
+	// 未注册的 pattern 统一用这个标签，避免乱七八糟的 pattern 把指标基数撑爆
+	unknownPatternLabel = "unknown"
+)
+
+// Prometheus 指标，通过 /metrics 暴露
+var (
+	handledTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_worker_messages_total",
+		Help: "Worker 处理的消息数，按 pattern 和处理结果区分",
+	}, []string{"pattern", "result"})
+
+	handleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "forum_worker_handle_duration_seconds",
+		Help:    "Worker 处理单条消息的耗时",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"pattern"})
+
+	inFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forum_worker_in_flight",
+		Help: "Worker 正在处理的消息数",
+	}, []string{"pattern"})
+)
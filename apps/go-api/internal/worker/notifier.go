@@ -2,54 +2,309 @@
 package worker
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"go-api/internal/config"
 	"go-api/internal/mailer"
+	"go-api/internal/models"
+	"go-api/internal/pkg/mq"
+	"go-api/internal/pkg/outbox"
 	"log"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type PostMessage struct {
-	Pattern string `json:"pattern"`
-	Data    struct {
-		PostID uint      `json:"postId"`
-		Title  string    `json:"title"`
-		Time   time.Time `json:"time"`
-	} `json:"data"`
+// 各个 pattern 的 data 部分，字段名与 mq.PublishXxx 保持一致
+
+type PostCreated struct {
+	PostID   uint      `json:"postId"`
+	AuthorID uint      `json:"authorId"` // 旧消息没有这个字段，为 0 时只通知订阅了整个论坛的用户
+	Title    string    `json:"title"`
+	Time     time.Time `json:"time"`
 }
 
-// 这是实际干脏活累活的函数
-func HandleNewPost(msgBody []byte) {
-	var msg PostMessage
-	err := json.Unmarshal(msgBody, &msg)
-	if err != nil {
-		log.Printf("❌ 解析消息失败: %v", err)
-		return
+type PostNotificationBatch struct {
+	PostID     uint           `json:"postId"`
+	Batch      int            `json:"batch"`
+	Title      string         `json:"title"`
+	Recipients []mq.Recipient `json:"recipients"`
+	Time       time.Time      `json:"time"`
+}
+
+type PostCommented struct {
+	PostID      uint      `json:"postId"`
+	CommentID   uint      `json:"commentId"`
+	Title       string    `json:"title"`
+	AuthorID    uint      `json:"authorId"`
+	AuthorEmail string    `json:"authorEmail"`
+	Time        time.Time `json:"time"`
+}
+
+type UserRegistered struct {
+	UserID    uint      `json:"userId"`
+	Email     string    `json:"email"`
+	VerifyURL string    `json:"verifyUrl"`
+	Time      time.Time `json:"time"`
+}
+
+type PasswordResetRequested struct {
+	UserID   uint      `json:"userId"`
+	Email    string    `json:"email"`
+	ResetURL string    `json:"resetUrl"`
+	Time     time.Time `json:"time"`
+}
+
+type SubscriptionChanged struct {
+	UserID    uint       `json:"userId"`
+	Email     string     `json:"email"`
+	IsPro     bool       `json:"isPro"`
+	PeriodEnd *time.Time `json:"periodEnd"`
+	Time      time.Time  `json:"time"`
+}
+
+// Notifier 发送各类通知邮件
+type Notifier struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	mailer *mailer.Mailer
+}
+
+func NewNotifier(db *gorm.DB, cfg *config.Config, m *mailer.Mailer) *Notifier {
+	return &Notifier{db: db, cfg: cfg, mailer: m}
+}
+
+// NewNotifierDispatcher 注册所有通知类消息的处理函数
+// 新帖通知会扇出给很多人，并发给低一点，避免把 SMTP 打满
+func NewNotifierDispatcher(db *gorm.DB, cfg *config.Config, m *mailer.Mailer) *Dispatcher {
+	n := NewNotifier(db, cfg, m)
+
+	d := NewDispatcher()
+	Register(d, mq.PatternPostCreated, 2, n.HandleNewPost)
+	Register(d, mq.PatternPostNotificationBatch, 2, n.HandlePostNotificationBatch)
+	Register(d, mq.PatternPostCommented, 4, n.HandlePostCommented)
+	Register(d, mq.PatternUserRegistered, 4, n.HandleUserRegistered)
+	Register(d, mq.PatternPasswordResetRequested, 4, n.HandlePasswordReset)
+	Register(d, mq.PatternSubscriptionChanged, 2, n.HandleSubscriptionChanged)
+	return d
+}
+
+// errAlreadyFannedOut 这篇帖子已经扇出过 (post_created 被重复投递)
+var errAlreadyFannedOut = errors.New("post notification already fanned out")
+
+// HandleNewPost 新帖扇出：按批查出订阅者，每批写一条 post_notification_batch 消息
+// 所有批次在同一个事务里写入 outbox，要么全部写入要么全部回滚
+// 每批在 PostNotificationBatch 登记 (PostID, 批次号)，重复投递时第 0 批冲突，直接跳过，不会重复扇出
+func (n *Notifier) HandleNewPost(msg PostCreated) error {
+	log.Printf("📥 [Go Worker] 收到新帖: ID=%d, Title=%s", msg.PostID, msg.Title)
+
+	batchSize := n.cfg.Notify.FanoutBatchSize
+	if batchSize <= 0 {
+		batchSize = 100
 	}
 
-	log.Printf("📥 [Go Worker] 收到新帖: ID=%d, Title=%s", msg.Data.PostID, msg.Data.Title)
+	batches := 0
+	total := 0
+	err := n.db.Transaction(func(tx *gorm.DB) error {
+		var lastID uint
+		for batch := 0; ; batch++ {
+			recipients, err := findSubscribers(tx, msg.AuthorID, lastID, batchSize)
+			if err != nil {
+				return err
+			}
+			// 第 0 批即使没有收件人也要登记，标记这篇帖子已经处理过
+			if len(recipients) == 0 && batch > 0 {
+				return nil
+			}
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PostNotificationBatch{
+				PostID:     msg.PostID,
+				Batch:      batch,
+				Recipients: len(recipients),
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errAlreadyFannedOut
+			}
+			if len(recipients) == 0 {
+				return nil
+			}
 
-	// 加载配置
-	cfg := config.Load()
+			if err := mq.PublishPostNotificationBatch(context.Background(), outbox.NewWriter(tx), msg.PostID, batch, msg.Title, recipients); err != nil {
+				return err
+			}
+			batches++
+			total += len(recipients)
+			lastID = recipients[len(recipients)-1].UserID
 
-	// 使用配置的域名拼接 URL
-	postURL := fmt.Sprintf("%s/posts/%d", cfg.App.FrontendURL, msg.Data.PostID)
+			if len(recipients) < batchSize {
+				return nil
+			}
+		}
+	})
+	if errors.Is(err, errAlreadyFannedOut) {
+		log.Printf("⚠️ [Go Worker] 新帖通知已经扇出过，跳过: PostID=%d", msg.PostID)
+		return nil
+	}
+	if err != nil {
+		log.Printf("❌ 新帖通知扇出失败: %v", err)
+		return err // 返回错误，交给 MQ 重试
+	}
+	log.Printf("✅ [Go Worker] 新帖通知已扇出: PostID=%d, 收件人=%d, 批次=%d", msg.PostID, total, batches)
+	return nil
+}
 
-	log.Printf("📧 [Go Worker] 正在发送邮件，帖子链接: %s", postURL)
+// findSubscribers 按用户 ID 游标分页查出需要通知的订阅者 (扇出时传入事务)
+// 订阅了整个论坛或者关注了作者的用户，排除作者本人、选择了摘要/关闭新帖通知和退订了邮件的用户
+func findSubscribers(db *gorm.DB, authorID, afterID uint, limit int) ([]mq.Recipient, error) {
+	var recipients []mq.Recipient
+	err := db.Model(&models.User{}).
+		Select(`"User".id AS user_id, "User".email, COALESCE(ns.locale, '') AS locale`).
+		Joins(`LEFT JOIN "NotificationSetting" ns ON ns."userId" = "User".id`).
+		Where(`"User".id > ? AND "User".id <> ?`, afterID, authorID).
+		Where(`EXISTS (SELECT 1 FROM "Subscription" s WHERE s."userId" = "User".id AND (s."targetType" = ? OR (s."targetType" = ? AND s."targetId" = ?)))`,
+			models.SubscriptionTargetForum, models.SubscriptionTargetAuthor, authorID).
+		Where(`ns."userId" IS NULL OR (ns."newPostFrequency" = ? AND ns."unsubscribedAt" IS NULL)`, models.FrequencyImmediate).
+		Order(`"User".id ASC`).
+		Limit(limit).
+		Scan(&recipients).Error
+	return recipients, err
+}
 
-	// 调用发邮件 (假设 SendPostNotification 内部已经有逻辑把 url 拼进去，或者我们需要修改该函数)
-	// 如果 mailer.SendPostNotification 之前是接收 postId 自己拼 url 的，
-	// 我们最好改成直接传 url，或者在 mailer 内部也读配置。
-	// 为了解耦，建议修改 mailer.SendPostNotification 接收完整 url 或者在 worker 里拼好 HTML。
+// localeOf 用户的邮件语言，没有设置时返回空 (渲染时回退到默认语言)
+func (n *Notifier) localeOf(userID uint) string {
+	var setting models.NotificationSetting
+	if err := n.db.Select("locale").Where("\"userId\" = ?", userID).Take(&setting).Error; err != nil {
+		return ""
+	}
+	return setting.Locale
+}
+
+// HandlePostNotificationBatch 给一批订阅者发新帖通知
+// 每发出一封就在 PostNotificationDelivery 记一笔，中途失败整批重试时跳过已经发过的收件人
+func (n *Notifier) HandlePostNotificationBatch(msg PostNotificationBatch) error {
+	postURL := fmt.Sprintf("%s/posts/%d", n.cfg.App.FrontendURL, msg.PostID)
 
-	// 这里我们假设之前 mailer.SendPostNotification 接收的是 postId。
-	// 我们去修改 mailer 包让它更通用，或者在这里临时处理。
-	// 最佳实践：修改 mailer 让它接收完整 Context。
-	err = mailer.SendPostNotification(cfg.Mail, "admin@example.com", msg.Data.Title, postURL)
+	// 扇出之后才退订/退信的用户，发送前再过滤一遍
+	emails := make([]string, 0, len(msg.Recipients))
+	userIDs := make([]uint, 0, len(msg.Recipients))
+	for _, r := range msg.Recipients {
+		emails = append(emails, r.Email)
+		userIDs = append(userIDs, r.UserID)
+	}
+	suppressed, err := suppressedEmails(n.db, emails, false)
 	if err != nil {
+		return err
+	}
+	delivered, err := n.deliveredTo(msg.PostID, userIDs)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, r := range msg.Recipients {
+		if delivered[r.UserID] {
+			continue
+		}
+		if suppressed[strings.ToLower(r.Email)] {
+			log.Printf("🚫 [Go Worker] 邮箱在抑制列表中，跳过: UserID=%d", r.UserID)
+			continue
+		}
+		if err := n.mailer.SendPostNotification(r.UserID, r.Email, r.Locale, msg.Title, postURL); err != nil {
+			log.Printf("❌ 邮件发送失败: UserID=%d, err=%v", r.UserID, err)
+			return err // 返回错误，交给 MQ 重试
+		}
+		if err := n.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PostNotificationDelivery{
+			PostID: msg.PostID,
+			UserID: r.UserID,
+			SentAt: time.Now(),
+		}).Error; err != nil {
+			log.Printf("❌ 记录发送结果失败: UserID=%d, err=%v", r.UserID, err)
+			return err
+		}
+		sent++
+	}
+	log.Printf("✅ [Go Worker] 新帖通知发送成功: PostID=%d, 批次=%d, 发送=%d/%d", msg.PostID, msg.Batch, sent, len(msg.Recipients))
+	return nil
+}
+
+// deliveredTo 这篇帖子的通知已经发给了哪些用户
+func (n *Notifier) deliveredTo(postID uint, userIDs []uint) (map[uint]bool, error) {
+	var ids []uint
+	if err := n.db.Model(&models.PostNotificationDelivery{}).
+		Where(`"postId" = ? AND "userId" IN ?`, postID, userIDs).
+		Pluck(`"userId"`, &ids).Error; err != nil {
+		return nil, err
+	}
+	delivered := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		delivered[id] = true
+	}
+	return delivered, nil
+}
+
+// HandlePostCommented 帖子有新评论时通知帖子作者
+func (n *Notifier) HandlePostCommented(msg PostCommented) error {
+	log.Printf("📥 [Go Worker] 收到新评论: PostID=%d, CommentID=%d", msg.PostID, msg.CommentID)
+	if skip, err := n.skipSuppressed(msg.AuthorEmail, false); skip || err != nil {
+		return err
+	}
+	postURL := fmt.Sprintf("%s/posts/%d#comment-%d", n.cfg.App.FrontendURL, msg.PostID, msg.CommentID)
+
+	if err := n.mailer.SendCommentNotification(msg.AuthorID, msg.AuthorEmail, n.localeOf(msg.AuthorID), msg.Title, postURL); err != nil {
+		log.Printf("❌ 邮件发送失败: %v", err)
+		return err
+	}
+	log.Printf("✅ [Go Worker] 评论通知发送成功!")
+	return nil
+}
+
+// HandleUserRegistered 发送邮箱验证邮件
+func (n *Notifier) HandleUserRegistered(msg UserRegistered) error {
+	log.Printf("📥 [Go Worker] 新用户注册: UserID=%d", msg.UserID)
+	if skip, err := n.skipSuppressed(msg.Email, true); skip || err != nil {
+		return err
+	}
+	if err := n.mailer.SendVerificationEmail(msg.Email, n.localeOf(msg.UserID), msg.VerifyURL); err != nil {
+		log.Printf("❌ 邮件发送失败: %v", err)
+		return err
+	}
+	log.Printf("✅ [Go Worker] 验证邮件发送成功!")
+	return nil
+}
+
+// HandlePasswordReset 发送重置密码邮件
+func (n *Notifier) HandlePasswordReset(msg PasswordResetRequested) error {
+	log.Printf("📥 [Go Worker] 重置密码申请: UserID=%d", msg.UserID)
+	if skip, err := n.skipSuppressed(msg.Email, true); skip || err != nil {
+		return err
+	}
+	if err := n.mailer.SendPasswordResetEmail(msg.Email, n.localeOf(msg.UserID), msg.ResetURL); err != nil {
 		log.Printf("❌ 邮件发送失败: %v", err)
-	} else {
-		log.Printf("✅ [Go Worker] 邮件发送成功!")
+		return err
+	}
+	log.Printf("✅ [Go Worker] 重置密码邮件发送成功!")
+	return nil
+}
+
+// HandleSubscriptionChanged Pro 订阅开通/取消，目前只记录日志 (不发邮件)
+func (n *Notifier) HandleSubscriptionChanged(msg SubscriptionChanged) error {
+	log.Printf("📥 [Go Worker] 订阅状态变更: UserID=%d, IsPro=%v", msg.UserID, msg.IsPro)
+	return nil
+}
+
+// skipSuppressed 邮箱在抑制列表里时返回 true (跳过发送，消息正常 ack)
+func (n *Notifier) skipSuppressed(email string, transactional bool) (bool, error) {
+	suppressed, err := isSuppressed(n.db, email, transactional)
+	if err != nil {
+		return false, err // 查不到抑制列表时交给 MQ 重试，宁可晚发也不要发给退订的人
+	}
+	if suppressed {
+		log.Printf("🚫 [Go Worker] 邮箱在抑制列表中，跳过")
 	}
+	return suppressed, nil
 }
@@ -0,0 +1,190 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"go-api/internal/config"
+	"go-api/internal/models"
+	"go-api/internal/pkg/mq"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OutboxRelay 定时扫描 Outbox 表，把待投递的消息发到 MQ
+// 投递成功标记为 sent，失败按指数退避重试，超过最大次数标记为 failed (管理后台可以重新排队)
+// MQ 不可用不算失败：不计入重试次数，停掉这一批，等下一个 tick 再试，MQ 停多久都不会丢消息
+type OutboxRelay struct {
+	db        *gorm.DB
+	publisher mq.Publisher
+	cfg       config.OutboxConfig
+}
+
+func NewOutboxRelay(db *gorm.DB, publisher mq.Publisher, cfg config.OutboxConfig) *OutboxRelay {
+	return &OutboxRelay{
+		db:        db,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+// Start 在后台运行，ctx 取消后退出
+func (r *OutboxRelay) Start(ctx context.Context) {
+	go func() {
+		log.Printf("📮 [Outbox Relay] 已启动，轮询间隔 %s", r.cfg.PollInterval)
+
+		ticker := time.NewTicker(r.cfg.PollInterval)
+		defer ticker.Stop()
+		lastPurge := time.Now()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("📮 [Outbox Relay] 已停止")
+				return
+			case <-ticker.C:
+			}
+
+			// 一批处理满了说明可能还有积压，继续处理，不等下一个 tick
+			for {
+				n, err := r.relayBatch(ctx)
+				if err != nil {
+					log.Printf("❌ [Outbox Relay] 处理失败: %v", err)
+					break
+				}
+				if n < r.cfg.BatchSize {
+					break
+				}
+			}
+
+			if time.Since(lastPurge) > time.Hour {
+				r.purgeSent(ctx)
+				lastPurge = time.Now()
+			}
+		}
+	}()
+}
+
+// relayBatch 领取一批到期的消息投递
+// 领取 (短事务，FOR UPDATE SKIP LOCKED 保证多实例不会领到同一条) -> 提交 -> 投递 -> 按租约写回结果
+// 投递期间不持有行锁，MQ 慢的时候不会拖住其它实例；投递成功但写回失败时租约过期后会重投 (至少一次)
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	events, leaseID, err := r.claim(ctx)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	for i, event := range events {
+		// payload 原样作为 data 发出，保证与直接投递的消息格式一致
+		err := r.publisher.Publish(ctx, event.Pattern, json.RawMessage(event.Payload))
+		if mq.IsUnavailable(err) {
+			// 返回 0 让外层不再继续领下一批，等 MQ 恢复
+			return 0, r.release(ctx, events[i:], leaseID, err)
+		}
+		if err := r.db.WithContext(ctx).Model(&models.OutboxEvent{}).
+			Where("id = ? AND \"leaseId\" = ?", event.ID, leaseID).
+			Updates(r.nextState(event, err)).Error; err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// claim 领取一批到期的消息：写入租约 ID，并把 nextAttemptAt 推到租约到期时间
+func (r *OutboxRelay) claim(ctx context.Context) ([]models.OutboxEvent, string, error) {
+	leaseID := uuid.New().String()
+	var events []models.OutboxEvent
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND \"nextAttemptAt\" <= ?", models.OutboxStatusPending, time.Now()).
+			Order("id").Limit(r.cfg.BatchSize).
+			Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(events))
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"leaseId": leaseID, "nextAttemptAt": time.Now().Add(r.cfg.Lease)}).Error
+	})
+	return events, leaseID, err
+}
+
+// release MQ 不可用：剩下的消息交还租约，下一个轮询间隔再试，不计入重试次数
+func (r *OutboxRelay) release(ctx context.Context, events []models.OutboxEvent, leaseID string, cause error) error {
+	ids := make([]uint, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	log.Printf("⚠️ [Outbox Relay] MQ 不可用，%d 条消息稍后重试: %v", len(ids), cause)
+	return r.db.WithContext(ctx).Model(&models.OutboxEvent{}).
+		Where("id IN ? AND \"leaseId\" = ?", ids, leaseID).
+		Updates(map[string]interface{}{
+			"lastError":     cause.Error(),
+			"leaseId":       "",
+			"nextAttemptAt": time.Now().Add(r.cfg.PollInterval),
+		}).Error
+}
+
+// nextState 根据投递结果计算这条消息的新状态
+func (r *OutboxRelay) nextState(event models.OutboxEvent, publishErr error) map[string]interface{} {
+	now := time.Now()
+	if publishErr == nil {
+		return map[string]interface{}{
+			"status":   models.OutboxStatusSent,
+			"attempts": event.Attempts + 1,
+			"sentAt":   now,
+			"leaseId":  "",
+		}
+	}
+
+	attempts := event.Attempts + 1
+	state := map[string]interface{}{
+		"attempts":  attempts,
+		"lastError": publishErr.Error(),
+		"leaseId":   "",
+	}
+	if attempts >= r.cfg.MaxAttempts {
+		state["status"] = models.OutboxStatusFailed
+		log.Printf("❌ [Outbox Relay] 消息投递失败次数过多，已放弃: ID=%d, Pattern=%s, Err=%v", event.ID, event.Pattern, publishErr)
+		return state
+	}
+
+	state["nextAttemptAt"] = now.Add(backoff(attempts, r.cfg.PollInterval, 10*time.Minute))
+	return state
+}
+
+// purgeSent 清理已投递且超过保留期的消息，避免表无限增长
+func (r *OutboxRelay) purgeSent(ctx context.Context) {
+	res := r.db.WithContext(ctx).
+		Where("status = ? AND \"sentAt\" < ?", models.OutboxStatusSent, time.Now().Add(-r.cfg.RetainSent)).
+		Delete(&models.OutboxEvent{})
+	if res.Error != nil {
+		log.Printf("❌ [Outbox Relay] 清理历史消息失败: %v", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("🧹 [Outbox Relay] 清理历史消息 %d 条", res.RowsAffected)
+	}
+}
+
+// backoff 指数退避：base * 2^(attempt-1)，不超过 max
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
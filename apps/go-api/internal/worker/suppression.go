@@ -0,0 +1,49 @@
+package worker
+
+import (
+	"strings"
+
+	"go-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// 这些原因对所有邮件生效；退订 (unsubscribe) 只屏蔽通知类邮件，验证邮箱、重置密码照常发
+var hardSuppressionReasons = []string{models.SuppressionBounce, models.SuppressionComplaint, models.SuppressionManual}
+
+// suppressedEmails 返回 emails 中在抑制列表里的邮箱 (小写)
+// transactional 为 true 时只看硬性原因 (退信、投诉、手动)
+func suppressedEmails(db *gorm.DB, emails []string, transactional bool) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(emails) == 0 {
+		return result, nil
+	}
+
+	lower := make([]string, 0, len(emails))
+	for _, e := range emails {
+		lower = append(lower, strings.ToLower(e))
+	}
+
+	query := db.Model(&models.EmailSuppression{}).Where("email IN ?", lower)
+	if transactional {
+		query = query.Where("reason IN ?", hardSuppressionReasons)
+	}
+
+	var hits []string
+	if err := query.Pluck("email", &hits).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range hits {
+		result[e] = true
+	}
+	return result, nil
+}
+
+// isSuppressed 单个邮箱是否在抑制列表里
+func isSuppressed(db *gorm.DB, email string, transactional bool) (bool, error) {
+	hits, err := suppressedEmails(db, []string{email}, transactional)
+	if err != nil {
+		return false, err
+	}
+	return hits[strings.ToLower(email)], nil
+}